@@ -0,0 +1,150 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// AABB is an axis-aligned bounding box.
+type AABB struct {
+	Min mgl32.Vec3
+	Max mgl32.Vec3
+}
+
+// BoundingSphere is a sphere enclosing a mesh.
+type BoundingSphere struct {
+	Center mgl32.Vec3
+	Radius float32
+}
+
+// ComputeAABB returns the box around a flat array of positions. An empty
+// array gives the zero box at the origin.
+func ComputeAABB(vertices []float32) AABB {
+	if len(vertices) < 3 {
+		return AABB{}
+	}
+
+	box := AABB{
+		Min: mgl32.Vec3{vertices[0], vertices[1], vertices[2]},
+		Max: mgl32.Vec3{vertices[0], vertices[1], vertices[2]},
+	}
+	for i := 3; i+2 < len(vertices); i += 3 {
+		for axis := 0; axis < 3; axis++ {
+			value := vertices[i+axis]
+			if value < box.Min[axis] {
+				box.Min[axis] = value
+			}
+			if value > box.Max[axis] {
+				box.Max[axis] = value
+			}
+		}
+	}
+	return box
+}
+
+// ComputeBoundingSphere returns a sphere around a flat array of positions,
+// centred on their box. This is not the smallest enclosing sphere, but it
+// is within a few percent of it for most meshes and costs a single pass.
+func ComputeBoundingSphere(vertices []float32, box AABB) BoundingSphere {
+	sphere := BoundingSphere{Center: box.Center()}
+
+	radiusSquared := float32(0)
+	for i := 0; i+2 < len(vertices); i += 3 {
+		dx := vertices[i] - sphere.Center[0]
+		dy := vertices[i+1] - sphere.Center[1]
+		dz := vertices[i+2] - sphere.Center[2]
+		if d := dx*dx + dy*dy + dz*dz; d > radiusSquared {
+			radiusSquared = d
+		}
+	}
+	sphere.Radius = float32(math.Sqrt(float64(radiusSquared)))
+	return sphere
+}
+
+// Center returns the middle of the box.
+func (b AABB) Center() mgl32.Vec3 {
+	return b.Min.Add(b.Max).Mul(0.5)
+}
+
+// Extents returns half the size of the box on each axis.
+func (b AABB) Extents() mgl32.Vec3 {
+	return b.Max.Sub(b.Min).Mul(0.5)
+}
+
+// Size returns the size of the box on each axis.
+func (b AABB) Size() mgl32.Vec3 {
+	return b.Max.Sub(b.Min)
+}
+
+// Contains reports whether point lies inside the box or on its surface.
+func (b AABB) Contains(point mgl32.Vec3) bool {
+	for axis := 0; axis < 3; axis++ {
+		if point[axis] < b.Min[axis] || point[axis] > b.Max[axis] {
+			return false
+		}
+	}
+	return true
+}
+
+// Intersects reports whether the two boxes overlap or touch.
+func (b AABB) Intersects(other AABB) bool {
+	for axis := 0; axis < 3; axis++ {
+		if b.Max[axis] < other.Min[axis] || other.Max[axis] < b.Min[axis] {
+			return false
+		}
+	}
+	return true
+}
+
+// Union returns the smallest box containing both boxes.
+func (b AABB) Union(other AABB) AABB {
+	for axis := 0; axis < 3; axis++ {
+		b.Min[axis] = float32(math.Min(float64(b.Min[axis]), float64(other.Min[axis])))
+		b.Max[axis] = float32(math.Max(float64(b.Max[axis]), float64(other.Max[axis])))
+	}
+	return b
+}
+
+// Transform returns the box around the eight corners of b transformed by
+// matrix. Rotations make the result larger than the transformed mesh's own
+// box, but it always contains it.
+func (b AABB) Transform(matrix mgl32.Mat4) AABB {
+	// Arvo's method: every matrix element adds its smaller product with the
+	// box's extremes to the new minimum and the larger one to the maximum.
+	result := AABB{Min: matrix.Col(3).Vec3(), Max: matrix.Col(3).Vec3()}
+	for row := 0; row < 3; row++ {
+		for column := 0; column < 3; column++ {
+			element := matrix.At(row, column)
+			a, c := element*b.Min[column], element*b.Max[column]
+			if a > c {
+				a, c = c, a
+			}
+			result.Min[row] += a
+			result.Max[row] += c
+		}
+	}
+	return result
+}
+
+// Contains reports whether point lies inside the sphere or on its surface.
+func (s BoundingSphere) Contains(point mgl32.Vec3) bool {
+	return point.Sub(s.Center).Len() <= s.Radius
+}
+
+// Intersects reports whether the two spheres overlap or touch.
+func (s BoundingSphere) Intersects(other BoundingSphere) bool {
+	return s.Center.Sub(other.Center).Len() <= s.Radius+other.Radius
+}
+
+// Transform returns the sphere moved by matrix. A non-uniform scale
+// stretches the sphere by its largest factor.
+func (s BoundingSphere) Transform(matrix mgl32.Mat4) BoundingSphere {
+	scale := float32(0)
+	for column := 0; column < 3; column++ {
+		scale = float32(math.Max(float64(scale), float64(matrix.Col(column).Vec3().Len())))
+	}
+	return BoundingSphere{
+		Center: matrix.Mul4x1(s.Center.Vec4(1)).Vec3(),
+		Radius: s.Radius * scale,
+	}
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"testing"
+)
+
+func TestComputeAABB(t *testing.T) {
+	tests := []struct {
+		name     string
+		vertices []float32
+		want     AABB
+	}{
+		{"empty", nil, AABB{}},
+		{"one point", []float32{1, 2, 3}, AABB{Min: mgl32.Vec3{1, 2, 3}, Max: mgl32.Vec3{1, 2, 3}}},
+		{"box", []float32{-1, 0, 2, 3, -4, 1, 0, 5, -2}, AABB{Min: mgl32.Vec3{-1, -4, -2}, Max: mgl32.Vec3{3, 5, 2}}},
+		{"trailing partial vertex", []float32{0, 0, 0, 1, 1, 1, 9, 9}, AABB{Max: mgl32.Vec3{1, 1, 1}}},
+	}
+	for _, test := range tests {
+		if got := ComputeAABB(test.vertices); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestComputeBoundingSphere(t *testing.T) {
+	vertices := []float32{-1, -1, -1, 1, 1, 1, 0, 0, 0}
+	sphere := ComputeBoundingSphere(vertices, ComputeAABB(vertices))
+	if sphere.Center != (mgl32.Vec3{}) || !approx(sphere.Radius, float32(math.Sqrt(3))) {
+		t.Errorf("got %v, want radius sqrt(3) at the origin", sphere)
+	}
+	for i := 0; i < len(vertices); i += 3 {
+		if point := (mgl32.Vec3{vertices[i], vertices[i+1], vertices[i+2]}); !sphere.Contains(point) {
+			t.Errorf("sphere %v leaves out %v", sphere, point)
+		}
+	}
+}
+
+func TestAABBTransform(t *testing.T) {
+	box := AABB{Min: mgl32.Vec3{0, 0, 0}, Max: mgl32.Vec3{2, 1, 1}}
+	tests := []struct {
+		name   string
+		matrix mgl32.Mat4
+		want   AABB
+	}{
+		{"identity", mgl32.Ident4(), box},
+		{"translation", mgl32.Translate3D(1, -2, 3), AABB{Min: mgl32.Vec3{1, -2, 3}, Max: mgl32.Vec3{3, -1, 4}}},
+		{"scale", mgl32.Scale3D(2, 3, -1), AABB{Min: mgl32.Vec3{0, 0, -1}, Max: mgl32.Vec3{4, 3, 0}}},
+		{"quarter turn about z", mgl32.HomogRotate3DZ(math.Pi / 2), AABB{Min: mgl32.Vec3{-1, 0, 0}, Max: mgl32.Vec3{0, 2, 1}}},
+		{"eighth turn about z", mgl32.HomogRotate3DZ(math.Pi / 4), AABB{
+			Min: mgl32.Vec3{-float32(math.Sqrt(0.5)), 0, 0},
+			Max: mgl32.Vec3{float32(2 * math.Sqrt(0.5)), float32(3 * math.Sqrt(0.5)), 1},
+		}},
+	}
+	for _, test := range tests {
+		got := box.Transform(test.matrix)
+		if !approxVec(got.Min, test.want.Min) || !approxVec(got.Max, test.want.Max) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBoundingSphereTransform(t *testing.T) {
+	sphere := BoundingSphere{Center: mgl32.Vec3{1, 0, 0}, Radius: 2}
+	tests := []struct {
+		name   string
+		matrix mgl32.Mat4
+		want   BoundingSphere
+	}{
+		{"translation", mgl32.Translate3D(0, 1, 2), BoundingSphere{Center: mgl32.Vec3{1, 1, 2}, Radius: 2}},
+		{"rotation", mgl32.HomogRotate3DZ(math.Pi / 2), BoundingSphere{Center: mgl32.Vec3{0, 1, 0}, Radius: 2}},
+		{"non-uniform scale", mgl32.Scale3D(1, 3, 0.5), BoundingSphere{Center: mgl32.Vec3{1, 0, 0}, Radius: 6}},
+	}
+	for _, test := range tests {
+		got := sphere.Transform(test.matrix)
+		if !approxVec(got.Center, test.want.Center) || !approx(got.Radius, test.want.Radius) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAABBRelations(t *testing.T) {
+	a := AABB{Min: mgl32.Vec3{0, 0, 0}, Max: mgl32.Vec3{1, 1, 1}}
+	tests := []struct {
+		name       string
+		other      AABB
+		intersects bool
+	}{
+		{"overlapping", AABB{Min: mgl32.Vec3{0.5, 0.5, 0.5}, Max: mgl32.Vec3{2, 2, 2}}, true},
+		{"touching", AABB{Min: mgl32.Vec3{1, 0, 0}, Max: mgl32.Vec3{2, 1, 1}}, true},
+		{"inside", AABB{Min: mgl32.Vec3{0.25, 0.25, 0.25}, Max: mgl32.Vec3{0.75, 0.75, 0.75}}, true},
+		{"apart on one axis", AABB{Min: mgl32.Vec3{0, 0, 1.5}, Max: mgl32.Vec3{1, 1, 2}}, false},
+	}
+	for _, test := range tests {
+		if got := a.Intersects(test.other); got != test.intersects {
+			t.Errorf("%s: Intersects got %v, want %v", test.name, got, test.intersects)
+		}
+		union := a.Union(test.other)
+		if !union.Contains(a.Min) || !union.Contains(a.Max) || !union.Contains(test.other.Min) || !union.Contains(test.other.Max) {
+			t.Errorf("%s: union %v does not contain both boxes", test.name, union)
+		}
+	}
+}
+
+func approx(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-5
+}
+
+func approxVec(a, b mgl32.Vec3) bool {
+	return approx(a[0], b[0]) && approx(a[1], b[1]) && approx(a[2], b[2])
+}
@@ -0,0 +1,87 @@
+package common
+
+import "github.com/go-gl/mathgl/mgl32"
+
+// Plane is the plane of points p with Normal.Dot(p) + D == 0. Points on the
+// side Normal points to have a positive distance.
+type Plane struct {
+	Normal mgl32.Vec3
+	D      float32
+}
+
+// Distance returns the signed distance of point from the plane. It is only
+// a true distance when Normal has unit length.
+func (p Plane) Distance(point mgl32.Vec3) float32 {
+	return p.Normal.Dot(point) + p.D
+}
+
+// Frustum is the volume a camera sees, as six planes facing inwards: left,
+// right, bottom, top, near and far.
+type Frustum [6]Plane
+
+// NewFrustum extracts the frustum of a combined projection and view matrix
+// (Gribb and Hartmann, "Fast Extraction of Viewing Frustum Planes from the
+// World-View-Projection Matrix"). The planes are in world space.
+func NewFrustum(viewProjection mgl32.Mat4) Frustum {
+	w := viewProjection.Row(3)
+	rows := [6]mgl32.Vec4{
+		w.Add(viewProjection.Row(0)),
+		w.Sub(viewProjection.Row(0)),
+		w.Add(viewProjection.Row(1)),
+		w.Sub(viewProjection.Row(1)),
+		w.Add(viewProjection.Row(2)),
+		w.Sub(viewProjection.Row(2)),
+	}
+
+	var frustum Frustum
+	for i, row := range rows {
+		normal := row.Vec3()
+		length := normal.Len()
+		if length == 0 {
+			continue
+		}
+		frustum[i] = Plane{Normal: normal.Mul(1 / length), D: row[3] / length}
+	}
+	return frustum
+}
+
+// ContainsPoint reports whether point is inside the frustum.
+func (f Frustum) ContainsPoint(point mgl32.Vec3) bool {
+	for _, plane := range f {
+		if plane.Distance(point) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IntersectsSphere reports whether any part of sphere may be inside the
+// frustum. Spheres near a corner, outside two planes but not fully outside
+// either, are kept.
+func (f Frustum) IntersectsSphere(sphere BoundingSphere) bool {
+	for _, plane := range f {
+		if plane.Distance(sphere.Center) < -sphere.Radius {
+			return false
+		}
+	}
+	return true
+}
+
+// IntersectsAABB reports whether any part of box may be inside the frustum.
+// As with IntersectsSphere, boxes near a corner can be kept when they are
+// outside.
+func (f Frustum) IntersectsAABB(box AABB) bool {
+	for _, plane := range f {
+		// The corner furthest along the normal is the last one to leave.
+		corner := box.Min
+		for axis := 0; axis < 3; axis++ {
+			if plane.Normal[axis] >= 0 {
+				corner[axis] = box.Max[axis]
+			}
+		}
+		if plane.Distance(corner) < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"testing"
+)
+
+// testFrustum looks from (0, 0, 5) towards the origin with a 90 degree
+// field of view, a square aspect and depth from 1 to 10.
+func testFrustum() Frustum {
+	projection := mgl32.Perspective(mgl32.DegToRad(90), 1, 1, 10)
+	view := mgl32.LookAtV(mgl32.Vec3{0, 0, 5}, mgl32.Vec3{}, mgl32.Vec3{0, 1, 0})
+	return NewFrustum(projection.Mul4(view))
+}
+
+func TestNewFrustum(t *testing.T) {
+	frustum := testFrustum()
+
+	// Plane order is left, right, bottom, top, near, far, each facing in.
+	want := Frustum{
+		{Normal: mgl32.Vec3{0.70710677, 0, -0.70710677}, D: 3.5355339},
+		{Normal: mgl32.Vec3{-0.70710677, 0, -0.70710677}, D: 3.5355339},
+		{Normal: mgl32.Vec3{0, 0.70710677, -0.70710677}, D: 3.5355339},
+		{Normal: mgl32.Vec3{0, -0.70710677, -0.70710677}, D: 3.5355339},
+		{Normal: mgl32.Vec3{0, 0, -1}, D: 4},
+		{Normal: mgl32.Vec3{0, 0, 1}, D: 5},
+	}
+	for i, plane := range frustum {
+		if !approxVec(plane.Normal, want[i].Normal) || !approx(plane.D, want[i].D) {
+			t.Errorf("plane %d: got %v, want %v", i, plane, want[i])
+		}
+	}
+}
+
+func TestFrustumIntersections(t *testing.T) {
+	frustum := testFrustum()
+	box := func(center mgl32.Vec3, half float32) AABB {
+		extent := mgl32.Vec3{half, half, half}
+		return AABB{Min: center.Sub(extent), Max: center.Add(extent)}
+	}
+
+	tests := []struct {
+		name   string
+		center mgl32.Vec3
+		half   float32
+		inside bool
+	}{
+		{"at the target", mgl32.Vec3{}, 0.5, true},
+		{"behind the camera", mgl32.Vec3{0, 0, 7}, 0.5, false},
+		{"closer than near", mgl32.Vec3{0, 0, 4.6}, 0.2, false},
+		{"across the near plane", mgl32.Vec3{0, 0, 4}, 0.5, true},
+		{"past far", mgl32.Vec3{0, 0, -6}, 0.5, false},
+		{"across the far plane", mgl32.Vec3{0, 0, -5}, 0.5, true},
+		{"left of the view", mgl32.Vec3{-8, 0, 0}, 1, false},
+		{"straddling the left plane", mgl32.Vec3{-5, 0, 0}, 0.5, true},
+		{"above the view", mgl32.Vec3{0, 8, 0}, 1, false},
+	}
+	for _, test := range tests {
+		if got := frustum.IntersectsAABB(box(test.center, test.half)); got != test.inside {
+			t.Errorf("%s: IntersectsAABB got %v, want %v", test.name, got, test.inside)
+		}
+		sphere := BoundingSphere{Center: test.center, Radius: test.half}
+		if got := frustum.IntersectsSphere(sphere); got != test.inside {
+			t.Errorf("%s: IntersectsSphere got %v, want %v", test.name, got, test.inside)
+		}
+		if got := frustum.ContainsPoint(test.center); got && !test.inside {
+			t.Errorf("%s: ContainsPoint reports the center inside", test.name)
+		}
+	}
+}
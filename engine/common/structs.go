@@ -1,12 +1,93 @@
 package common
 
+import "github.com/go-gl/mathgl/mgl32"
+
+// TextureMap is a texture referenced by a material, together with the options
+// given for it in the material file.
+type TextureMap struct {
+	Path           string
+	Scale          mgl32.Vec3 // -s
+	Offset         mgl32.Vec3 // -o
+	Clamp          bool       // -clamp
+	BumpMultiplier float32    // -bm
+
+	// Embedded holds the encoded image for textures stored inside a model
+	// file rather than next to it. Path is empty in that case.
+	Embedded []byte
+}
+
+// NewTextureMap returns a TextureMap for path with the MTL default options.
+func NewTextureMap(path string) TextureMap {
+	return TextureMap{
+		Path:           path,
+		Scale:          mgl32.Vec3{1, 1, 1},
+		BumpMultiplier: 1,
+	}
+}
+
+// BlendMode says how the alpha of a material is used.
+type BlendMode int
+
+const (
+	// BlendOpaque ignores alpha.
+	BlendOpaque BlendMode = iota
+	// BlendCutout discards fragments whose alpha is below AlphaCutoff and
+	// draws the rest as opaque.
+	BlendCutout
+	// BlendBlended mixes fragments with what is behind them by their alpha.
+	BlendBlended
+)
+
 type Material struct {
-	Name         string
-	TextureID    uint32
-	DiffuseMap   string
-	NormalMap    string
-	SpecularMap  string
-	RoughnessMap string
+	Name      string
+	TextureID uint32
+
+	Ambient   mgl32.Vec3 // Ka
+	Diffuse   mgl32.Vec3 // Kd
+	Specular  mgl32.Vec3 // Ks
+	Emissive  mgl32.Vec3 // Ke
+	Shininess float32    // Ns
+	Dissolve  float32    // d, or 1 - Tr
+	Illum     int
+	Roughness float32 // Pr
+	Metallic  float32 // Pm
+
+	BlendMode   BlendMode // glTF alphaMode; for MTL, guessed from d and map_d
+	AlphaCutoff float32   // glTF alphaCutoff
+	// PBR selects metallic-roughness shading. glTF materials always use it,
+	// MTL materials when they give Pr, Pm or their maps.
+	PBR bool
+
+	DiffuseMap   TextureMap // map_Kd
+	NormalMap    TextureMap // map_Bump, bump, norm
+	SpecularMap  TextureMap // map_Ks
+	RoughnessMap TextureMap // map_Pr
+	MetallicMap  TextureMap // map_Pm
+	AlphaMap     TextureMap // map_d
+	AmbientMap   TextureMap // map_Ka
+	EmissiveMap  TextureMap // map_Ke
+	OcclusionMap TextureMap // glTF occlusionTexture
+}
+
+// NewMaterial returns a material with the defaults used when an MTL file
+// leaves a property out.
+func NewMaterial(name string) *Material {
+	return &Material{
+		Name:        name,
+		Diffuse:     mgl32.Vec3{1, 1, 1},
+		Dissolve:    1,
+		Roughness:   1,
+		AlphaCutoff: 0.5,
+	}
+}
+
+// Submesh is a contiguous range of an ObjectPrimitive's indices that is drawn
+// with a single material.
+type Submesh struct {
+	Name        string
+	Material    string
+	IndexOffset int
+	IndexCount  int
 }
 
 type ObjectPrimitive struct {
@@ -14,7 +95,92 @@ type ObjectPrimitive struct {
 	Indices  []uint32
 	Normals  []float32
 	UVs      []float32
+	Tangents []float32 // xyz plus handedness in w
+
+	// Interleaved holds every vertex attribute in the layout Interleave
+	// produces, for loaders that read it that way, such as LoadMeshCache.
+	// They fill Vertices but leave UVs, Normals and Tangents empty; call
+	// SplitInterleaved before reading or changing those.
+	Interleaved []float32
+
+	Submeshes   []Submesh
+	MaterialLib string               // resolved path of the model's material library
+	Materials   map[string]*Material // materials embedded in the model, by name
 
 	Textures map[string]uint32
 	Material *Material
+
+	// Bounds and Sphere enclose Vertices in model space. Loaders fill them
+	// in; call UpdateBounds after changing Vertices.
+	Bounds AABB
+	Sphere BoundingSphere
+}
+
+// UpdateBounds recomputes Bounds and Sphere from Vertices.
+func (obj *ObjectPrimitive) UpdateBounds() {
+	obj.Bounds = ComputeAABB(obj.Vertices)
+	obj.Sphere = ComputeBoundingSphere(obj.Vertices, obj.Bounds)
+}
+
+// VertexStride is the number of floats per vertex produced by Interleave:
+// position (3), UV (2), normal (3) and tangent (4).
+const VertexStride = 12
+
+// Interleave packs the vertex attributes into a single buffer in the layout
+// the renderer uploads, filling defaults for missing attributes. Interleaved
+// is returned as it is when it holds every vertex.
+func (obj *ObjectPrimitive) Interleave() []float32 {
+	if obj.hasInterleaved() {
+		return obj.Interleaved
+	}
+
+	combinedVertices := make([]float32, 0, len(obj.Vertices)/3*VertexStride)
+	for i := 0; i < len(obj.Vertices)/3; i++ {
+		combinedVertices = append(combinedVertices, obj.Vertices[i*3], obj.Vertices[i*3+1], obj.Vertices[i*3+2])
+
+		if i < len(obj.UVs)/2 {
+			combinedVertices = append(combinedVertices, obj.UVs[i*2], obj.UVs[i*2+1])
+		} else {
+			combinedVertices = append(combinedVertices, 0.0, 0.0) // Default UV
+		}
+
+		if i < len(obj.Normals)/3 {
+			combinedVertices = append(combinedVertices, obj.Normals[i*3], obj.Normals[i*3+1], obj.Normals[i*3+2])
+		} else {
+			combinedVertices = append(combinedVertices, 0.0, 0.0, 0.0) // Default normal
+		}
+
+		if i < len(obj.Tangents)/4 {
+			combinedVertices = append(combinedVertices, obj.Tangents[i*4], obj.Tangents[i*4+1], obj.Tangents[i*4+2], obj.Tangents[i*4+3])
+		} else {
+			combinedVertices = append(combinedVertices, 1.0, 0.0, 0.0, 1.0) // Default tangent
+		}
+	}
+	return combinedVertices
+}
+
+func (obj *ObjectPrimitive) hasInterleaved() bool {
+	return len(obj.Interleaved) > 0 && len(obj.Interleaved) == len(obj.Vertices)/3*VertexStride
+}
+
+// SplitInterleaved fills UVs, Normals and Tangents from Interleaved and then
+// clears it, so that the separate arrays are the only copy of the vertices
+// again. It does nothing when Interleaved is empty.
+func (obj *ObjectPrimitive) SplitInterleaved() {
+	if !obj.hasInterleaved() {
+		obj.Interleaved = nil
+		return
+	}
+
+	vertexCount := len(obj.Vertices) / 3
+	obj.UVs = make([]float32, vertexCount*2)
+	obj.Normals = make([]float32, vertexCount*3)
+	obj.Tangents = make([]float32, vertexCount*4)
+	for v := 0; v < vertexCount; v++ {
+		vertex := obj.Interleaved[v*VertexStride : (v+1)*VertexStride]
+		copy(obj.UVs[v*2:], vertex[3:5])
+		copy(obj.Normals[v*3:], vertex[5:8])
+		copy(obj.Tangents[v*4:], vertex[8:12])
+	}
+	obj.Interleaved = nil
 }
@@ -0,0 +1,171 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// Transform places an object with a translation, a rotation and a scale that
+// are stored separately, so setting one never disturbs the others. The model
+// matrix scales, then rotates, then translates, and is only recomputed when
+// it is asked for after a change.
+type Transform struct {
+	position mgl32.Vec3
+	rotation mgl32.Quat
+	scale    mgl32.Vec3
+
+	matrix  mgl32.Mat4
+	dirty   bool
+	version uint64
+}
+
+// NewTransform returns the identity transform.
+func NewTransform() *Transform {
+	return &Transform{
+		rotation: mgl32.QuatIdent(),
+		scale:    mgl32.Vec3{1, 1, 1},
+		matrix:   mgl32.Ident4(),
+	}
+}
+
+func (t *Transform) Position() mgl32.Vec3 {
+	return t.position
+}
+
+func (t *Transform) Rotation() mgl32.Quat {
+	return t.rotation
+}
+
+func (t *Transform) Scale() mgl32.Vec3 {
+	return t.scale
+}
+
+func (t *Transform) SetPosition(position mgl32.Vec3) {
+	t.position = position
+	t.changed()
+}
+
+// SetRotation replaces the rotation. rotation is normalized first.
+func (t *Transform) SetRotation(rotation mgl32.Quat) {
+	t.rotation = rotation.Normalize()
+	t.changed()
+}
+
+func (t *Transform) SetScale(scale mgl32.Vec3) {
+	t.scale = scale
+	t.changed()
+}
+
+func (t *Transform) changed() {
+	t.dirty = true
+	t.version++
+}
+
+// Version counts the changes made to the transform, so that values derived
+// from it can tell when they are stale.
+func (t *Transform) Version() uint64 {
+	return t.version
+}
+
+// Translate moves the transform by offset in its parent's space.
+func (t *Transform) Translate(offset mgl32.Vec3) {
+	t.SetPosition(t.position.Add(offset))
+}
+
+// TranslateLocal moves the transform by offset along its own axes, so that
+// {0, 0, -1} always moves it forward.
+func (t *Transform) TranslateLocal(offset mgl32.Vec3) {
+	t.Translate(t.rotation.Rotate(offset))
+}
+
+// Rotate applies rotation after the current rotation, about the axes of the
+// parent's space.
+func (t *Transform) Rotate(rotation mgl32.Quat) {
+	t.SetRotation(rotation.Mul(t.rotation))
+}
+
+// RotateLocal applies rotation before the current rotation, about the
+// transform's own axes.
+func (t *Transform) RotateLocal(rotation mgl32.Quat) {
+	t.SetRotation(t.rotation.Mul(rotation))
+}
+
+// LookAt turns the transform so that its forward axis, -Z, points at target
+// and its up axis is as close to up as possible. Nothing changes when target
+// is the position or lies straight along up.
+func (t *Transform) LookAt(target, up mgl32.Vec3) {
+	forward := target.Sub(t.position)
+	if forward.Len() == 0 {
+		return
+	}
+	forward = forward.Normalize()
+
+	right := forward.Cross(up)
+	if right.Len() < 1e-6 {
+		return
+	}
+	right = right.Normalize()
+	up = right.Cross(forward)
+
+	t.SetRotation(mgl32.Mat4ToQuat(mgl32.Mat4{
+		right[0], right[1], right[2], 0,
+		up[0], up[1], up[2], 0,
+		-forward[0], -forward[1], -forward[2], 0,
+		0, 0, 0, 1,
+	}))
+}
+
+// Forward returns the direction the transform faces, its -Z axis.
+func (t *Transform) Forward() mgl32.Vec3 {
+	return t.rotation.Rotate(mgl32.Vec3{0, 0, -1})
+}
+
+// Right returns the transform's +X axis.
+func (t *Transform) Right() mgl32.Vec3 {
+	return t.rotation.Rotate(mgl32.Vec3{1, 0, 0})
+}
+
+// Up returns the transform's +Y axis.
+func (t *Transform) Up() mgl32.Vec3 {
+	return t.rotation.Rotate(mgl32.Vec3{0, 1, 0})
+}
+
+// SetEulerAngles sets the rotation from angles in radians, applied as roll
+// about Z, then pitch about X, then yaw about Y, the order the camera uses.
+func (t *Transform) SetEulerAngles(pitch, yaw, roll float32) {
+	t.SetRotation(mgl32.QuatRotate(yaw, mgl32.Vec3{0, 1, 0}).
+		Mul(mgl32.QuatRotate(pitch, mgl32.Vec3{1, 0, 0})).
+		Mul(mgl32.QuatRotate(roll, mgl32.Vec3{0, 0, 1})))
+}
+
+// EulerAngles returns the pitch, yaw and roll in radians that SetEulerAngles
+// would need to produce the current rotation. Pitch is within ±π/2; when it
+// is at either end, yaw and roll turn about the same axis and roll is
+// reported as zero.
+func (t *Transform) EulerAngles() (pitch, yaw, roll float32) {
+	m := t.rotation.Mat4()
+
+	sinPitch := -m.At(1, 2)
+	if sinPitch >= 1-1e-6 || sinPitch <= -1+1e-6 {
+		pitch = float32(math.Copysign(math.Pi/2, float64(sinPitch)))
+		yaw = float32(math.Atan2(float64(m.At(0, 1)*sinPitch), float64(m.At(0, 0))))
+		return pitch, yaw, 0
+	}
+
+	pitch = float32(math.Asin(float64(sinPitch)))
+	yaw = float32(math.Atan2(float64(m.At(0, 2)), float64(m.At(2, 2))))
+	roll = float32(math.Atan2(float64(m.At(1, 0)), float64(m.At(1, 1))))
+	return pitch, yaw, roll
+}
+
+// Matrix returns the model matrix, recomputing it if the transform changed
+// since it was last asked for.
+func (t *Transform) Matrix() mgl32.Mat4 {
+	if t.dirty {
+		t.matrix = mgl32.Translate3D(t.position[0], t.position[1], t.position[2]).
+			Mul4(t.rotation.Mat4()).
+			Mul4(mgl32.Scale3D(t.scale[0], t.scale[1], t.scale[2]))
+		t.dirty = false
+	}
+	return t.matrix
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"testing"
+)
+
+func approxMat(a, b mgl32.Mat4) bool {
+	for i := range a {
+		if !approx(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTransformMatrix(t *testing.T) {
+	transform := NewTransform()
+	if transform.Matrix() != mgl32.Ident4() {
+		t.Errorf("new transform has matrix %v", transform.Matrix())
+	}
+
+	transform.SetScale(mgl32.Vec3{2, 2, 2})
+	transform.SetRotation(mgl32.QuatRotate(math.Pi/2, mgl32.Vec3{0, 1, 0}))
+	transform.SetPosition(mgl32.Vec3{0, 0, 5})
+	if transform.Version() != 3 {
+		t.Errorf("version %d after three changes", transform.Version())
+	}
+
+	// Scaled to (2, 0, 0), turned to (0, 0, -2), then moved.
+	if got := transform.Matrix().Mul4x1(mgl32.Vec4{1, 0, 0, 1}).Vec3(); !approxVec(got, mgl32.Vec3{0, 0, 3}) {
+		t.Errorf("got %v, want (0, 0, 3)", got)
+	}
+
+	transform.TranslateLocal(mgl32.Vec3{0, 0, -1})
+	if got := transform.Position(); !approxVec(got, mgl32.Vec3{-1, 0, 5}) {
+		t.Errorf("moving forward went to %v, want (-1, 0, 5)", got)
+	}
+}
+
+func TestTransformEulerAngles(t *testing.T) {
+	tests := []struct {
+		name             string
+		pitch, yaw, roll float32
+		gimbalLock       bool
+	}{
+		{"zero", 0, 0, 0, false},
+		{"yaw", 0, 1, 0, false},
+		{"pitch", -0.5, 0, 0, false},
+		{"roll", 0, 0, 2.5, false},
+		{"all three", 0.3, -2, 1.2, false},
+		{"looking up", math.Pi / 2, 0.7, 0.2, true},
+		{"looking down", -math.Pi / 2, -1, 0.4, true},
+	}
+
+	for _, test := range tests {
+		transform := NewTransform()
+		transform.SetEulerAngles(test.pitch, test.yaw, test.roll)
+		pitch, yaw, roll := transform.EulerAngles()
+
+		again := NewTransform()
+		again.SetEulerAngles(pitch, yaw, roll)
+		if !approxMat(again.Matrix(), transform.Matrix()) {
+			t.Errorf("%s: angles %v %v %v do not give the same rotation back", test.name, pitch, yaw, roll)
+		}
+		if test.gimbalLock {
+			if !approx(pitch, test.pitch) || roll != 0 {
+				t.Errorf("%s: got pitch %v and roll %v, want pitch %v and no roll", test.name, pitch, roll, test.pitch)
+			}
+		} else if !approx(pitch, test.pitch) || !approx(yaw, test.yaw) || !approx(roll, test.roll) {
+			t.Errorf("%s: got %v %v %v, want %v %v %v", test.name, pitch, yaw, roll, test.pitch, test.yaw, test.roll)
+		}
+	}
+}
+
+func TestTransformLookAt(t *testing.T) {
+	up := mgl32.Vec3{0, 1, 0}
+	tests := []struct {
+		name             string
+		position, target mgl32.Vec3
+		moves            bool
+	}{
+		{"forward", mgl32.Vec3{}, mgl32.Vec3{0, 0, -3}, true},
+		{"behind", mgl32.Vec3{1, 2, 3}, mgl32.Vec3{1, 2, 10}, true},
+		{"diagonal", mgl32.Vec3{0, 0, 0}, mgl32.Vec3{1, -1, 1}, true},
+		{"at its own position", mgl32.Vec3{1, 1, 1}, mgl32.Vec3{1, 1, 1}, false},
+		{"straight up", mgl32.Vec3{}, mgl32.Vec3{0, 5, 0}, false},
+	}
+
+	for _, test := range tests {
+		transform := NewTransform()
+		transform.SetPosition(test.position)
+		start := transform.Rotation()
+		transform.LookAt(test.target, up)
+
+		if !test.moves {
+			if transform.Rotation() != start {
+				t.Errorf("%s: rotation changed to %v", test.name, transform.Rotation())
+			}
+			continue
+		}
+
+		want := test.target.Sub(test.position).Normalize()
+		if !approxVec(transform.Forward(), want) {
+			t.Errorf("%s: forward is %v, want %v", test.name, transform.Forward(), want)
+		}
+		if !approx(transform.Right().Dot(up), 0) || transform.Up().Dot(up) <= 0 {
+			t.Errorf("%s: right %v and up %v are not level", test.name, transform.Right(), transform.Up())
+		}
+
+		// The Euler angles of the result describe the same rotation.
+		pitch, yaw, roll := transform.EulerAngles()
+		again := NewTransform()
+		again.SetEulerAngles(pitch, yaw, roll)
+		if !approxVec(again.Forward(), want) {
+			t.Errorf("%s: Euler angles face %v, want %v", test.name, again.Forward(), want)
+		}
+	}
+}
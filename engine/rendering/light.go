@@ -0,0 +1,164 @@
+package rendering
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// MaxLights is the number of lights the lit shader takes. Lights added
+// beyond it are ignored, in the order they were added.
+const MaxLights = 16
+
+type LightType int
+
+const (
+	// DirectionalLight lights the whole scene from one direction, like the
+	// sun. Position, Range and attenuation are ignored.
+	DirectionalLight LightType = iota
+	// PointLight shines in every direction from Position.
+	PointLight
+	// SpotLight shines from Position in a cone around Direction.
+	SpotLight
+)
+
+// Light is a light source of the scene. Point and spot lights fade with
+// distance d by 1 / (Constant + Linear*d + Quadratic*d²), and reach nothing
+// beyond Range, if it is set.
+type Light struct {
+	Type      LightType
+	Position  mgl32.Vec3
+	Direction mgl32.Vec3 // the way the light travels
+	Color     mgl32.Vec3
+	Intensity float32
+
+	Range     float32
+	Constant  float32
+	Linear    float32
+	Quadratic float32
+
+	// InnerCone and OuterCone are the angles in radians from Direction of
+	// a spot light's full-strength core and of the edge it fades out at.
+	InnerCone float32
+	OuterCone float32
+
+	// CastShadows gives the light a shadow map, or for a point light a cube
+	// map if it is among the Renderer's Shadows.PointShadows nearest. Depths
+	// within ShadowBias of the map's are lit; a point light's map holds
+	// distances as a fraction of its range, which the bias is measured in
+	// too. ShadowNormalBias moves the lookup that many shadow map texels
+	// off the surface. Both keep surfaces from shadowing themselves.
+	CastShadows      bool
+	ShadowBias       float32
+	ShadowNormalBias float32
+}
+
+// Default biases of new lights. A spot light's map stores perspective depth,
+// which changes far more slowly with distance than the orthographic depth of
+// a directional light's, so it needs a smaller bias.
+const (
+	defaultShadowBias       = 0.0005
+	defaultSpotShadowBias   = 0.00005
+	defaultShadowNormalBias = 1.5
+)
+
+// NewDirectionalLight returns a light shining along direction.
+func NewDirectionalLight(direction, color mgl32.Vec3, intensity float32) *Light {
+	return &Light{
+		Type:      DirectionalLight,
+		Direction: direction.Normalize(),
+		Color:     color,
+		Intensity: intensity,
+		Constant:  1,
+
+		ShadowBias:       defaultShadowBias,
+		ShadowNormalBias: defaultShadowNormalBias,
+	}
+}
+
+// NewPointLight returns a light at position that reaches lightRange, with
+// an inverse square falloff.
+func NewPointLight(position, color mgl32.Vec3, intensity, lightRange float32) *Light {
+	return &Light{
+		Type:      PointLight,
+		Position:  position,
+		Color:     color,
+		Intensity: intensity,
+		Range:     lightRange,
+		Constant:  1,
+		Quadratic: 1,
+
+		ShadowBias:       defaultShadowBias,
+		ShadowNormalBias: defaultShadowNormalBias,
+	}
+}
+
+// NewSpotLight returns a light at position shining along direction, with its
+// core and edge at the given angles in radians.
+func NewSpotLight(position, direction, color mgl32.Vec3, intensity, lightRange, innerCone, outerCone float32) *Light {
+	return &Light{
+		Type:      SpotLight,
+		Position:  position,
+		Direction: direction.Normalize(),
+		Color:     color,
+		Intensity: intensity,
+		Range:     lightRange,
+		Constant:  1,
+		Quadratic: 1,
+		InnerCone: innerCone,
+		OuterCone: outerCone,
+
+		ShadowBias:       defaultSpotShadowBias,
+		ShadowNormalBias: defaultShadowNormalBias,
+	}
+}
+
+// AddLight adds light to the scene. The light is read every frame, so it can
+// be changed after it is added.
+func (r *Renderer) AddLight(light *Light) {
+	r.lights = append(r.lights, light)
+}
+
+// RemoveLight removes light from the scene, reporting whether it was there.
+func (r *Renderer) RemoveLight(light *Light) bool {
+	for i, l := range r.lights {
+		if l == light {
+			r.lights = append(r.lights[:i], r.lights[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Lights returns the lights of the scene. The slice must not be modified.
+func (r *Renderer) Lights() []*Light {
+	return r.lights
+}
+
+// setLights uploads up to MaxLights lights to shader, with the layers of
+// their maps in shadows.
+func setLights(shader *Shader, lights []*Light, shadows *shadowState) {
+	if len(lights) > MaxLights {
+		lights = lights[:MaxLights]
+	}
+	shader.SetInt("lightCount", len(lights))
+
+	for i, light := range lights {
+		prefix := fmt.Sprintf("lights[%d].", i)
+		shader.SetInt(prefix+"type", int(light.Type))
+		shader.SetVec3(prefix+"position", light.Position)
+		direction := light.Direction
+		if direction.Len() > 0 {
+			direction = direction.Normalize()
+		}
+		shader.SetVec3(prefix+"direction", direction)
+		shader.SetVec3(prefix+"color", light.Color.Mul(light.Intensity))
+		shader.SetFloat(prefix+"range", light.Range)
+		shader.SetVec3(prefix+"attenuation", mgl32.Vec3{light.Constant, light.Linear, light.Quadratic})
+		shader.SetFloat(prefix+"innerCos", float32(math.Cos(float64(light.InnerCone))))
+		shader.SetFloat(prefix+"outerCos", float32(math.Cos(float64(light.OuterCone))))
+		shader.SetInt(prefix+"shadowMap", shadows.shadowMap(light))
+		shader.SetFloat(prefix+"shadowBias", light.ShadowBias)
+		shader.SetFloat(prefix+"normalBias", light.ShadowNormalBias)
+	}
+}
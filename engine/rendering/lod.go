@@ -0,0 +1,125 @@
+package rendering
+
+import (
+	"fmt"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/tools"
+	"github.com/go-gl/gl/v4.2-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// LODLevel requests one level of detail for RenderableObject.GenerateLODs.
+type LODLevel struct {
+	// Ratio is the fraction of the full mesh's triangles to keep.
+	Ratio float32
+	// ScreenSize is the height of the object on screen, as a fraction of
+	// the viewport height, below which this level is drawn.
+	ScreenSize float32
+}
+
+// LOD is a simplified index buffer that shares the vertex buffer of the
+// object it belongs to.
+type LOD struct {
+	EBO        uint32
+	Indices    []uint32
+	Submeshes  []common.Submesh
+	ScreenSize float32
+}
+
+// GenerateLODs simplifies the object's mesh once for every level and uploads
+// the results. Levels are simplified one from the next and should go from
+// most to least detailed. Any previously generated levels are replaced. If a
+// level could not remove any triangles, the levels before it are kept and an
+// error wrapping tools.ErrNotSimplified is returned.
+func (obj *RenderableObject) GenerateLODs(levels ...LODLevel) error {
+	obj.DeleteLODs()
+
+	mesh := &common.ObjectPrimitive{
+		Vertices:  obj.Vertices,
+		Normals:   obj.Normals,
+		UVs:       obj.TexCoords,
+		Tangents:  obj.Tangents,
+		Indices:   obj.Indices,
+		Submeshes: obj.Submeshes,
+
+		Interleaved: obj.interleaved,
+	}
+	triangles := len(obj.Indices) / 3
+
+	for i, level := range levels {
+		target := int(float32(triangles) * level.Ratio)
+		indices, submeshes := tools.SimplifyIndices(mesh, target)
+		if before := len(mesh.Indices) / 3; target < before && len(indices)/3 >= before {
+			gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, 0)
+			return fmt.Errorf("LOD %d kept all %d triangles: %w", i, before, tools.ErrNotSimplified)
+		}
+
+		var ebo uint32
+		gl.GenBuffers(1, &ebo)
+		gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, ebo)
+		if len(indices) > 0 {
+			gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(indices)*4, gl.Ptr(indices), gl.STATIC_DRAW)
+		}
+
+		obj.LODs = append(obj.LODs, LOD{
+			EBO:        ebo,
+			Indices:    indices,
+			Submeshes:  submeshes,
+			ScreenSize: level.ScreenSize,
+		})
+		mesh.Indices, mesh.Submeshes = indices, submeshes
+	}
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, 0)
+	return nil
+}
+
+// DeleteLODs frees the index buffers of all generated levels.
+func (obj *RenderableObject) DeleteLODs() {
+	for _, lod := range obj.LODs {
+		gl.DeleteBuffers(1, &lod.EBO)
+	}
+	obj.LODs = nil
+	obj.currentLOD = -1
+}
+
+// SelectLOD picks the level Draw uses from the object's size on screen: the
+// least detailed level whose ScreenSize the object is smaller than, or the
+// full mesh if there is none.
+func (obj *RenderableObject) SelectLOD(camera Camera, projection mgl32.Mat4) {
+	obj.currentLOD = -1
+	if len(obj.LODs) == 0 {
+		return
+	}
+
+	size := obj.ScreenSize(camera, projection)
+	for i, lod := range obj.LODs {
+		if size < lod.ScreenSize {
+			obj.currentLOD = i
+		}
+	}
+}
+
+// CurrentLOD returns the index into LODs of the level Draw uses, or -1 for
+// the full mesh.
+func (obj *RenderableObject) CurrentLOD() int {
+	return obj.currentLOD
+}
+
+// ScreenSize returns the projected height of the object's bounding sphere as
+// a fraction of the viewport height. It is infinite when the camera is
+// inside the sphere.
+func (obj *RenderableObject) ScreenSize(camera Camera, projection mgl32.Mat4) float32 {
+	sphere := obj.WorldSphere()
+	center, radius := sphere.Center, sphere.Radius
+
+	eye := mgl32.Vec3{float32(camera.Position.X()), float32(camera.Position.Y()), float32(camera.Position.Z())}
+	distance := center.Sub(eye).Len()
+	if distance <= radius {
+		return float32(math.Inf(1))
+	}
+
+	// projection[1][1] is cot(fov/2), which maps a height at unit distance
+	// to half the viewport.
+	return radius * projection.At(1, 1) / distance
+}
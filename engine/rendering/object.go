@@ -15,15 +15,42 @@ type RenderableObject struct {
 	Vertices  []float32
 	Normals   []float32
 	TexCoords []float32
+	Tangents  []float32
 	Indices   []uint32
+	Submeshes []common.Submesh
+	// interleaved holds the vertices of meshes loaded already interleaved,
+	// whose TexCoords, Normals and Tangents are left empty.
+	interleaved []float32
 
 	Material          map[string]*common.Material
+	materialIndex     map[string]int
 	AlbedoTextures    []uint32
 	NormalTextures    []uint32
 	SpecularTextures  []uint32
 	RoughnessTextures []uint32
+	MetallicTextures  []uint32
+	OcclusionTextures []uint32
+	EmissiveTextures  []uint32
+	AlphaTextures     []uint32
 
-	ModelMatrix mgl32.Mat4
+	// Shader draws the object in place of the renderer's when set.
+	Shader *Shader
+
+	// CastShadows puts the object in the shadow maps of lights, and
+	// ReceiveShadows darkens it where they are blocked. Both start out set.
+	CastShadows    bool
+	ReceiveShadows bool
+
+	LODs       []LOD
+	currentLOD int
+
+	bounds common.AABB
+	sphere common.BoundingSphere
+
+	// Transform places the object relative to its scene node's parent, or
+	// in the world if it is not in a scene.
+	Transform *common.Transform
+	node      *SceneNode
 }
 
 func NewRenderableObject(obj *common.ObjectPrimitive, mtlPath string) *RenderableObject {
@@ -31,6 +58,10 @@ func NewRenderableObject(obj *common.ObjectPrimitive, mtlPath string) *Renderabl
 	gl.GenVertexArrays(1, &vao)
 	gl.BindVertexArray(vao)
 
+	if len(obj.Tangents) == 0 && obj.Interleaved == nil {
+		tools.GenerateTangents(obj)
+	}
+
 	combinedVertices := CombineVertices(obj)
 
 	gl.GenBuffers(1, &vbo)
@@ -41,7 +72,7 @@ func NewRenderableObject(obj *common.ObjectPrimitive, mtlPath string) *Renderabl
 	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, ebo)
 	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(obj.Indices)*4, gl.Ptr(obj.Indices), gl.STATIC_DRAW)
 
-	stride := int32(32)
+	stride := int32(common.VertexStride * 4)
 
 	gl.VertexAttribPointer(0, 3, gl.FLOAT, false, stride, gl.PtrOffset(0))
 	gl.EnableVertexAttribArray(0)
@@ -49,13 +80,22 @@ func NewRenderableObject(obj *common.ObjectPrimitive, mtlPath string) *Renderabl
 	gl.VertexAttribPointer(1, 2, gl.FLOAT, false, stride, gl.PtrOffset(12))
 	gl.EnableVertexAttribArray(1)
 
-	gl.VertexAttribPointer(2, 3, gl.FLOAT, false, stride, gl.PtrOffset(18))
+	gl.VertexAttribPointer(2, 3, gl.FLOAT, false, stride, gl.PtrOffset(20))
 	gl.EnableVertexAttribArray(2)
 
+	gl.VertexAttribPointer(3, 4, gl.FLOAT, false, stride, gl.PtrOffset(32))
+	gl.EnableVertexAttribArray(3)
+
 	gl.BindVertexArray(0)
 
 	var albedoTextures, normalTextures, specularTextures, roughnessTextures []uint32
-	materials, err := tools.ParseMTL(mtlPath)
+	var metallicTextures, occlusionTextures, emissiveTextures, alphaTextures []uint32
+	materialIndex := make(map[string]int)
+	materials := obj.Materials
+	var err error
+	if materials == nil && mtlPath != "" {
+		materials, err = tools.ParseMTL(mtlPath)
+	}
 	if err != nil {
 
 		fmt.Println("Failed to parse mtl file: ", err)
@@ -63,14 +103,37 @@ func NewRenderableObject(obj *common.ObjectPrimitive, mtlPath string) *Renderabl
 		fmt.Println("Parsed materials from file: ", materials)
 
 		for name, material := range materials {
-			albedoTextures = append(albedoTextures, loadTextureWithFallback(material.DiffuseMap, "(A)", name))
-			normalTextures = append(normalTextures, loadTextureWithFallback(material.NormalMap, "(N)", name))
-			specularTextures = append(specularTextures, loadTextureWithFallback(material.SpecularMap, "(S)", name))
-			roughnessTextures = append(roughnessTextures, loadTextureWithFallback(material.RoughnessMap, "(R)", name))
+			materialIndex[name] = len(albedoTextures)
+			// Maps a material does not have are replaced by ones that leave
+			// its factors as they are: white, or a flat normal.
+			albedoTextures = append(albedoTextures, loadOptionalTexture(material.DiffuseMap, "(A)", name, neutralTexture))
+			normalTextures = append(normalTextures, loadOptionalTexture(material.NormalMap, "(N)", name, createFlatNormalTexture))
+			specularTextures = append(specularTextures, loadOptionalTexture(material.SpecularMap, "(S)", name, neutralTexture))
+			roughnessTextures = append(roughnessTextures, loadOptionalTexture(material.RoughnessMap, "(R)", name, neutralTexture))
+			occlusionTextures = append(occlusionTextures, loadOptionalTexture(material.OcclusionMap, "(O)", name, neutralTexture))
+			emissiveTextures = append(emissiveTextures, loadOptionalTexture(material.EmissiveMap, "(E)", name, neutralTexture))
+			alphaTextures = append(alphaTextures, loadOptionalTexture(material.AlphaMap, "(D)", name, neutralTexture))
+
+			// glTF packs roughness and metalness into one image.
+			if sameTexture(material.MetallicMap, material.RoughnessMap) {
+				metallicTextures = append(metallicTextures, roughnessTextures[len(roughnessTextures)-1])
+			} else {
+				metallicTextures = append(metallicTextures, loadOptionalTexture(material.MetallicMap, "(M)", name, neutralTexture))
+			}
 		}
 
 	}
 
+	submeshes := obj.Submeshes
+	if len(submeshes) == 0 {
+		submeshes = []common.Submesh{{IndexCount: len(obj.Indices)}}
+	}
+
+	// Meshes assembled by hand rather than loaded have no bounds yet.
+	if obj.Bounds == (common.AABB{}) && len(obj.Vertices) >= 3 {
+		obj.UpdateBounds()
+	}
+
 	return &RenderableObject{
 		VAO:               vao,
 		VBO:               vbo,
@@ -78,87 +141,228 @@ func NewRenderableObject(obj *common.ObjectPrimitive, mtlPath string) *Renderabl
 		Vertices:          obj.Vertices,
 		Normals:           obj.Normals,
 		TexCoords:         obj.UVs,
+		Tangents:          obj.Tangents,
+		interleaved:       obj.Interleaved,
 		Indices:           obj.Indices,
-		ModelMatrix:       mgl32.Ident4(),
+		Submeshes:         submeshes,
+		Transform:         common.NewTransform(),
 		Material:          materials,
+		materialIndex:     materialIndex,
 		AlbedoTextures:    albedoTextures,
 		NormalTextures:    normalTextures,
 		SpecularTextures:  specularTextures,
 		RoughnessTextures: roughnessTextures,
+		MetallicTextures:  metallicTextures,
+		OcclusionTextures: occlusionTextures,
+		EmissiveTextures:  emissiveTextures,
+		AlphaTextures:     alphaTextures,
+		CastShadows:       true,
+		ReceiveShadows:    true,
+		currentLOD:        -1,
+		bounds:            obj.Bounds,
+		sphere:            obj.Sphere,
 	}
 }
 
-func (obj *RenderableObject) Draw(shader *Shader) {
-	gl.BindVertexArray(obj.VAO)
+// LocalBounds returns the box around the mesh in model space.
+func (obj *RenderableObject) LocalBounds() common.AABB {
+	return obj.bounds
+}
 
-	shader.SetMat4ByName("model", obj.ModelMatrix)
+// LocalSphere returns the sphere around the mesh in model space.
+func (obj *RenderableObject) LocalSphere() common.BoundingSphere {
+	return obj.sphere
+}
 
-	for i, texture := range obj.AlbedoTextures {
-		gl.ActiveTexture(uint32(gl.TEXTURE0 + i))
-		gl.BindTexture(gl.TEXTURE_2D, texture)
-		shader.SetInt(fmt.Sprintf("texture%d", i), int(int32(i)))
+// ModelMatrix returns the matrix from the object's space to the world,
+// including the transforms of the scene nodes above it.
+func (obj *RenderableObject) ModelMatrix() mgl32.Mat4 {
+	if obj.node != nil {
+		return obj.node.WorldMatrix()
 	}
+	return obj.Transform.Matrix()
+}
 
-	gl.DrawElements(gl.TRIANGLES, int32(len(obj.Indices)), gl.UNSIGNED_INT, gl.PtrOffset(0))
+// Node returns the scene node holding the object, or nil if it has not been
+// added to a renderer.
+func (obj *RenderableObject) Node() *SceneNode {
+	return obj.node
+}
 
-	gl.BindTexture(gl.TEXTURE_2D, 0)
-	gl.BindVertexArray(0)
+// WorldBounds returns the box around the mesh transformed by ModelMatrix. It
+// is computed on every call, so callers checking many times a frame should
+// keep the result.
+func (obj *RenderableObject) WorldBounds() common.AABB {
+	return obj.bounds.Transform(obj.ModelMatrix())
+}
+
+// WorldSphere returns the sphere around the mesh transformed by ModelMatrix.
+func (obj *RenderableObject) WorldSphere() common.BoundingSphere {
+	return obj.sphere.Transform(obj.ModelMatrix())
+}
+
+// InFrustum reports whether the object's world bounds may be visible. The
+// sphere is tested first as it is cheaper and rejects most objects; the box
+// then catches long, thin objects whose sphere is much larger than them.
+func (obj *RenderableObject) InFrustum(frustum common.Frustum) bool {
+	return frustum.IntersectsSphere(obj.WorldSphere()) && frustum.IntersectsAABB(obj.WorldBounds())
+}
+
+// textures returns the maps of the named material by texture unit. An
+// unknown material, as on meshes loaded without one, gets the first loaded
+// albedo texture and neutral maps, so that it is drawn white, matte and not
+// metallic as setMaterial describes.
+func (obj *RenderableObject) textures(material string) [TextureUnits]uint32 {
+	var textures [TextureUnits]uint32
+	i, ok := obj.materialIndex[material]
+	if !ok {
+		for unit := range textures {
+			textures[unit] = neutralTexture()
+		}
+		textures[AlbedoUnit] = obj.albedoTexture(material)
+		textures[NormalUnit] = createFlatNormalTexture()
+		return textures
+	}
+
+	for unit, maps := range [TextureUnits][]uint32{
+		AlbedoUnit:    obj.AlbedoTextures,
+		AlphaUnit:     obj.AlphaTextures,
+		NormalUnit:    obj.NormalTextures,
+		RoughnessUnit: obj.RoughnessTextures,
+		MetallicUnit:  obj.MetallicTextures,
+		OcclusionUnit: obj.OcclusionTextures,
+		EmissiveUnit:  obj.EmissiveTextures,
+	} {
+		if i < len(maps) {
+			textures[unit] = maps[i]
+		}
+	}
+	return textures
 }
 
+// albedoTexture returns the diffuse texture of the named material, falling
+// back to the first loaded texture when the material is unknown, and to
+// white when there is none.
+func (obj *RenderableObject) albedoTexture(material string) uint32 {
+	if i, ok := obj.materialIndex[material]; ok {
+		return obj.AlbedoTextures[i]
+	}
+	if len(obj.AlbedoTextures) > 0 {
+		return obj.AlbedoTextures[0]
+	}
+	return neutralTexture()
+}
+
+// SetPosition, SetRotation and SetScale replace one part of the object's
+// Transform and keep the other two.
 func (obj *RenderableObject) SetPosition(position mgl32.Vec3) {
 	if obj != nil {
-		obj.ModelMatrix = mgl32.Translate3D(position.X(), position.Y(), position.Z())
+		obj.Transform.SetPosition(position)
 	}
 }
 
 func (obj *RenderableObject) SetRotation(rotation mgl32.Quat) {
 	if obj != nil {
-		rotationMatrix := rotation.Mat4()
-		obj.ModelMatrix = obj.ModelMatrix.Mul4(rotationMatrix)
+		obj.Transform.SetRotation(rotation)
 	}
 }
 
 func (obj *RenderableObject) SetScale(scale mgl32.Vec3) {
 	if obj != nil {
-		scaleMatrix := mgl32.Scale3D(scale.X(), scale.Y(), scale.Z())
-		obj.ModelMatrix = obj.ModelMatrix.Mul4(scaleMatrix)
+		obj.Transform.SetScale(scale)
 	}
 }
 
+// SetColor replaces every albedo map of the object with a texture of a
+// single colour, so that all of its materials are drawn in that colour. The
+// previous textures are not deleted.
 func (obj *RenderableObject) SetColor(R, G, B, A uint8) {
 	if obj != nil {
 		tex := tools.CreateColorMaterial(R, G, B, A)
-		obj.AlbedoTextures = append(obj.AlbedoTextures, tex)
+		if len(obj.AlbedoTextures) == 0 {
+			obj.AlbedoTextures = append(obj.AlbedoTextures, tex)
+		}
+		for i := range obj.AlbedoTextures {
+			obj.AlbedoTextures[i] = tex
+		}
 	}
 }
 
 func CombineVertices(obj *common.ObjectPrimitive) []float32 {
-	combinedVertices := make([]float32, 0, len(obj.Vertices)+len(obj.UVs)+len(obj.Normals))
-	for i := 0; i < len(obj.Vertices)/3; i++ {
-		combinedVertices = append(combinedVertices, obj.Vertices[i*3], obj.Vertices[i*3+1], obj.Vertices[i*3+2])
-
-		if i < len(obj.UVs)/2 {
-			combinedVertices = append(combinedVertices, obj.UVs[i*2], obj.UVs[i*2+1])
-		} else {
-			combinedVertices = append(combinedVertices, 0.0, 0.0) // Default UV
-		}
+	return obj.Interleave()
+}
 
-		if i < len(obj.Normals)/3 {
-			combinedVertices = append(combinedVertices, obj.Normals[i*3], obj.Normals[i*3+1], obj.Normals[i*3+2])
-		} else {
-			combinedVertices = append(combinedVertices, 0.0, 0.0, 0.0) // Default normal
-		}
+// loadOptionalTexture loads a map that a material may leave out, calling
+// missing to create the texture used in its place.
+func loadOptionalTexture(textureMap common.TextureMap, textureType string, name string, missing func() uint32) uint32 {
+	if textureMap.Path == "" && textureMap.Embedded == nil {
+		return missing()
+	}
+	return loadTextureWithFallback(textureMap, textureType, name)
+}
+
+// sameTexture reports whether two maps refer to the same image.
+func sameTexture(a, b common.TextureMap) bool {
+	if len(a.Embedded) > 0 || len(b.Embedded) > 0 {
+		return len(a.Embedded) > 0 && len(b.Embedded) > 0 && &a.Embedded[0] == &b.Embedded[0]
 	}
-	return combinedVertices
+	return a.Path != "" && a.Path == b.Path
 }
 
-func loadTextureWithFallback(texturePath string, textureType string, name string) uint32 {
+// Textures standing in for maps a material leaves out, created on first use
+// and shared by every object.
+var whiteTexture, flatNormalTexture uint32
+
+// neutralTexture returns a texel of full white, which leaves the factor a map
+// multiplies as it is. tools.CreateWhiteTexture is a light grey and would
+// darken it.
+func neutralTexture() uint32 {
+	if whiteTexture == 0 {
+		whiteTexture = tools.CreateColorMaterial(255, 255, 255, 255)
+	}
+	return whiteTexture
+}
+
+// createFlatNormalTexture returns a normal map texel pointing straight out
+// of the surface.
+func createFlatNormalTexture() uint32 {
+	if flatNormalTexture == 0 {
+		flatNormalTexture = tools.CreateColorMaterial(128, 128, 255, 255)
+	}
+	return flatNormalTexture
+}
+
+// applyTextureOptions sets the sampling state a texture map asks for. Its
+// scale and offset are applied in the shaders; see uvTransform.
+func applyTextureOptions(texture uint32, textureMap common.TextureMap) {
+	if !textureMap.Clamp {
+		return
+	}
+	gl.BindTexture(gl.TEXTURE_2D, texture)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+func loadTextureWithFallback(textureMap common.TextureMap, textureType string, name string) uint32 {
+	if textureMap.Embedded != nil {
+		tex, err := tools.LoadTextureData(textureMap.Embedded)
+		if err != nil {
+			fmt.Println("Failed to load embedded texture for", textureType, "in material", name, ": ", err)
+			return tools.CreatePinkTexture()
+		}
+		applyTextureOptions(tex, textureMap)
+		return tex
+	}
+
+	texturePath := textureMap.Path
 	if texturePath != "" {
 		tex, err := tools.LoadTexture(texturePath)
 		if err != nil {
 			fmt.Println("Failed to load texture for", textureType, "in material", name, ": ", err)
 			return tools.CreatePinkTexture()
 		}
+		applyTextureOptions(tex, textureMap)
 		return tex
 	} else {
 		fmt.Println("No texture path for", textureType, "in material", name)
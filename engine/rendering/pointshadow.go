@@ -0,0 +1,134 @@
+package rendering
+
+import (
+	"fmt"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"github.com/go-gl/gl/v4.2-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"sort"
+)
+
+// MaxPointShadows is the number of point light cube maps the lit shaders
+// take.
+const MaxPointShadows = 4
+
+// pointShadowMapUnit is the texture unit the point light cube maps are bound
+// to.
+const pointShadowMapUnit = shadowMapUnit + 1
+
+// pointShadowNear is the near plane of point light cube maps.
+const pointShadowNear = 0.05
+
+// pointShadow is the cube map of one point light. It stores the distance
+// from the light divided by far rather than perspective depth, so the
+// shaders can compare distances along any direction.
+type pointShadow struct {
+	light *Light
+	far   float32
+}
+
+// cubeFaces are the directions and up vectors of the cube map faces, in the
+// order OpenGL lays them out: +X, -X, +Y, -Y, +Z, -Z.
+var cubeFaces = [6][2]mgl32.Vec3{
+	{{1, 0, 0}, {0, -1, 0}},
+	{{-1, 0, 0}, {0, -1, 0}},
+	{{0, 1, 0}, {0, 0, 1}},
+	{{0, -1, 0}, {0, 0, -1}},
+	{{0, 0, 1}, {0, -1, 0}},
+	{{0, 0, -1}, {0, -1, 0}},
+}
+
+// selectPointShadows gives a cube map to up to budget shadow-casting point
+// lights, those nearest to eye first. Lights without a Range reach distance.
+func (s *shadowState) selectPointShadows(lights []*Light, eye mgl32.Vec3, budget int, distance float32) {
+	if budget > MaxPointShadows {
+		budget = MaxPointShadows
+	}
+	if budget <= 0 {
+		return
+	}
+
+	for _, light := range lights {
+		if light.Type != PointLight || !light.CastShadows {
+			continue
+		}
+		far := light.Range
+		if far <= 0 {
+			far = distance
+		}
+		s.points = append(s.points, pointShadow{light: light, far: far})
+	}
+
+	sort.SliceStable(s.points, func(i, j int) bool {
+		return s.points[i].light.Position.Sub(eye).Len() < s.points[j].light.Position.Sub(eye).Len()
+	})
+	if len(s.points) > budget {
+		s.points = s.points[:budget]
+	}
+	for i, point := range s.points {
+		s.firstMap[point.light] = i
+	}
+}
+
+// allocatePoints makes sure the cube map array holds at least cubes cube maps
+// with faces of size by size texels. Like allocate, it only grows.
+func (s *shadowState) allocatePoints(size, cubes int) {
+	if s.pointTexture != 0 && s.pointSize == size && s.pointCubes >= cubes {
+		return
+	}
+	if s.pointTexture != 0 {
+		gl.DeleteTextures(1, &s.pointTexture)
+	}
+
+	gl.GenTextures(1, &s.pointTexture)
+	gl.BindTexture(gl.TEXTURE_CUBE_MAP_ARRAY, s.pointTexture)
+	gl.TexImage3D(gl.TEXTURE_CUBE_MAP_ARRAY, 0, gl.DEPTH_COMPONENT32F, int32(size), int32(size), int32(cubes*6), 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP_ARRAY, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP_ARRAY, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP_ARRAY, gl.TEXTURE_COMPARE_MODE, gl.COMPARE_REF_TO_TEXTURE)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP_ARRAY, gl.TEXTURE_COMPARE_FUNC, gl.LEQUAL)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP_ARRAY, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP_ARRAY, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP_ARRAY, gl.TEXTURE_WRAP_R, gl.CLAMP_TO_EDGE)
+	gl.BindTexture(gl.TEXTURE_CUBE_MAP_ARRAY, 0)
+
+	s.pointSize, s.pointCubes = size, cubes
+}
+
+// renderPointShadows renders the cube map of each selected point light into
+// the bound framebuffer. The whole array is attached at once and the
+// geometry shader sends each triangle to all six faces of the light's cube,
+// so every light takes a single pass over its casters.
+func (r *Renderer) renderPointShadows(size int) {
+	s := &r.shadows
+	gl.Viewport(0, 0, int32(size), int32(size))
+	gl.FramebufferTexture(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, s.pointTexture, 0)
+	// Clearing a layered attachment clears every layer, so it is done once
+	// for all the lights.
+	gl.Clear(gl.DEPTH_BUFFER_BIT)
+
+	s.pointShader.Use()
+	for unit, sampler := range textureSamplers {
+		s.pointShader.SetInt(sampler, unit)
+	}
+
+	for cube, point := range s.points {
+		light := point.light
+		projection := mgl32.Perspective(mgl32.DegToRad(90), 1, pointShadowNear, point.far)
+		for face, axes := range cubeFaces {
+			view := mgl32.LookAtV(light.Position, light.Position.Add(axes[0]), axes[1])
+			s.pointShader.SetMat4ByName(fmt.Sprintf("faceMatrices[%d]", face), projection.Mul4(view))
+		}
+		s.pointShader.SetInt("cube", cube)
+		s.pointShader.SetVec3("lightPosition", light.Position)
+		s.pointShader.SetFloat("farPlane", point.far)
+
+		reach := common.BoundingSphere{Center: light.Position, Radius: point.far}
+		r.Scene.Walk(func(node *SceneNode) bool {
+			if object := node.Object; object != nil && object.CastShadows && object.WorldSphere().Intersects(reach) {
+				object.drawDepth(s.pointShader)
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package rendering
+
+import (
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"github.com/go-gl/gl/v4.2-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"sort"
+)
+
+// Texture units the material maps are bound to.
+const (
+	AlbedoUnit = iota
+	AlphaUnit
+	NormalUnit
+	RoughnessUnit
+	MetallicUnit
+	OcclusionUnit
+	EmissiveUnit
+	TextureUnits
+)
+
+// textureSamplers names the sampler uniform of each texture unit.
+var textureSamplers = [TextureUnits]string{
+	AlbedoUnit:    "texture0",
+	AlphaUnit:     "alphaMap",
+	NormalUnit:    "normalMap",
+	RoughnessUnit: "roughnessMap",
+	MetallicUnit:  "metallicMap",
+	OcclusionUnit: "occlusionMap",
+	EmissiveUnit:  "emissiveMap",
+}
+
+// DrawItem is one submesh of an object, with everything needed to draw it.
+type DrawItem struct {
+	Object   *RenderableObject
+	Shader   *Shader
+	Material *common.Material
+	// Textures holds the material's maps by texture unit.
+	Textures [TextureUnits]uint32
+	EBO      uint32
+	Submesh  common.Submesh
+	Model    mgl32.Mat4
+	// Depth is the distance in front of the camera of the object's bounding
+	// sphere centre.
+	Depth float32
+
+	materialID int
+}
+
+// RenderQueue collects the draw items of a frame so they can be drawn in an
+// order that does not depend on how they were gathered. Opaque and cutout
+// items are drawn first, opaque ones before cutouts since discarding
+// fragments defeats early depth testing. They are grouped by shader, material
+// and texture to save state changes, and drawn front to back within a group
+// so that the depth test rejects hidden fragments early. Blended items are
+// drawn back to front after them, without writing depth, so that each
+// blends over everything behind it. Items that compare equal keep the order
+// they were added.
+type RenderQueue struct {
+	Opaque      []DrawItem
+	Transparent []DrawItem
+
+	materials map[*common.Material]int
+}
+
+// Reset empties the queue, keeping its buffers.
+func (q *RenderQueue) Reset() {
+	q.Opaque = q.Opaque[:0]
+	q.Transparent = q.Transparent[:0]
+	for material := range q.materials {
+		delete(q.materials, material)
+	}
+}
+
+// Add queues item. Materials are numbered in the order they are first seen,
+// which keeps the sort independent of where they sit in memory.
+func (q *RenderQueue) Add(item DrawItem) {
+	if q.materials == nil {
+		q.materials = make(map[*common.Material]int)
+	}
+	id, ok := q.materials[item.Material]
+	if !ok {
+		id = len(q.materials)
+		q.materials[item.Material] = id
+	}
+	item.materialID = id
+
+	if blendMode(item.Material) == common.BlendBlended {
+		q.Transparent = append(q.Transparent, item)
+	} else {
+		q.Opaque = append(q.Opaque, item)
+	}
+}
+
+// blendMode returns the blend mode of material, treating a missing material
+// as opaque.
+func blendMode(material *common.Material) common.BlendMode {
+	if material == nil {
+		return common.BlendOpaque
+	}
+	return material.BlendMode
+}
+
+// Sort orders both lists for drawing.
+func (q *RenderQueue) Sort() {
+	sort.SliceStable(q.Opaque, func(i, j int) bool {
+		a, b := &q.Opaque[i], &q.Opaque[j]
+		if modeA, modeB := blendMode(a.Material), blendMode(b.Material); modeA != modeB {
+			return modeA < modeB
+		}
+		if a.Shader.Program != b.Shader.Program {
+			return a.Shader.Program < b.Shader.Program
+		}
+		if a.materialID != b.materialID {
+			return a.materialID < b.materialID
+		}
+		if a.Textures != b.Textures {
+			for unit := range a.Textures {
+				if a.Textures[unit] != b.Textures[unit] {
+					return a.Textures[unit] < b.Textures[unit]
+				}
+			}
+		}
+		return a.Depth < b.Depth
+	})
+
+	sort.SliceStable(q.Transparent, func(i, j int) bool {
+		return q.Transparent[i].Depth > q.Transparent[j].Depth
+	})
+}
+
+// Submit draws the opaque and cutout items, then the blended ones, in their
+// current order. setup is called each time a shader is bound, to set the
+// uniforms that are the same for the whole frame, such as the camera and
+// lights. State is only changed when it differs from the previous item's.
+func (q *RenderQueue) Submit(setup func(shader *Shader)) {
+	state := submitState{setup: setup}
+	state.draw(q.Opaque)
+
+	if len(q.Transparent) > 0 {
+		gl.Enable(gl.BLEND)
+		gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+		gl.DepthMask(false)
+		state.draw(q.Transparent)
+		gl.DepthMask(true)
+		gl.Disable(gl.BLEND)
+	}
+
+	for unit := TextureUnits - 1; unit >= 0; unit-- {
+		gl.ActiveTexture(gl.TEXTURE0 + uint32(unit))
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+	}
+	gl.BindVertexArray(0)
+}
+
+// submitState remembers what Submit last bound.
+type submitState struct {
+	setup func(shader *Shader)
+
+	shader      *Shader
+	material    *common.Material
+	materialSet bool
+	receive     bool
+	receiveSet  bool
+	vao, ebo    uint32
+	textures    [TextureUnits]uint32
+}
+
+func (s *submitState) draw(items []DrawItem) {
+	for i := range items {
+		item := &items[i]
+
+		if item.Shader != s.shader {
+			s.shader = item.Shader
+			s.shader.Use()
+			s.setup(s.shader)
+			for unit, sampler := range textureSamplers {
+				s.shader.SetInt(sampler, unit)
+			}
+			s.materialSet = false
+			s.receiveSet = false
+		}
+		if !s.materialSet || item.Material != s.material {
+			s.material = item.Material
+			s.materialSet = true
+			setMaterial(s.shader, s.material)
+		}
+		if !s.receiveSet || item.Object.ReceiveShadows != s.receive {
+			s.receive = item.Object.ReceiveShadows
+			s.receiveSet = true
+			s.shader.SetBool("receiveShadows", s.receive)
+		}
+		if item.Object.VAO != s.vao {
+			s.vao = item.Object.VAO
+			gl.BindVertexArray(s.vao)
+			s.ebo = 0
+		}
+		// The element buffer binding belongs to the VAO.
+		if item.EBO != s.ebo {
+			s.ebo = item.EBO
+			gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, s.ebo)
+		}
+		for unit, texture := range item.Textures {
+			if texture != s.textures[unit] {
+				s.textures[unit] = texture
+				gl.ActiveTexture(gl.TEXTURE0 + uint32(unit))
+				gl.BindTexture(gl.TEXTURE_2D, texture)
+			}
+		}
+
+		s.shader.SetMat4ByName("model", item.Model)
+		gl.DrawElements(gl.TRIANGLES, int32(item.Submesh.IndexCount), gl.UNSIGNED_INT, gl.PtrOffset(item.Submesh.IndexOffset*4))
+	}
+}
+
+// setMaterial sets the uniforms the fragment shaders take from material. A
+// missing material is white, matte and not metallic. Opaque materials keep
+// an opacity of 1 and a cutoff of 0, which never discards.
+func setMaterial(shader *Shader, material *common.Material) {
+	diffuse, specular, emissive := mgl32.Vec3{1, 1, 1}, mgl32.Vec3{}, mgl32.Vec3{}
+	shininess, roughness, metallic, normalScale := float32(1), float32(1), float32(0), float32(1)
+	if material != nil {
+		diffuse, specular, emissive = material.Diffuse, material.Specular, material.Emissive
+		// Ns 0 would light every fragment as if facing the highlight.
+		shininess = float32(math.Max(float64(material.Shininess), 1))
+		roughness, metallic = material.Roughness, material.Metallic
+		// A map that was never set has a zero multiplier, which is taken as 1.
+		if material.NormalMap.BumpMultiplier != 0 {
+			normalScale = material.NormalMap.BumpMultiplier
+		}
+	}
+	shader.SetVec3("diffuseColor", diffuse)
+	shader.SetVec3("specularColor", specular)
+	shader.SetFloat("shininess", shininess)
+	shader.SetVec3("emissiveColor", emissive)
+	shader.SetFloat("roughness", roughness)
+	shader.SetFloat("metallic", metallic)
+	shader.SetFloat("normalScale", normalScale)
+
+	uvScale, uvOffset := mgl32.Vec2{1, 1}, mgl32.Vec2{}
+	if material != nil {
+		uvScale, uvOffset = uvTransform(material.DiffuseMap)
+	}
+	shader.SetVec2("uvScale", uvScale)
+	shader.SetVec2("uvOffset", uvOffset)
+
+	opacity, cutoff := float32(1), float32(0)
+	switch blendMode(material) {
+	case common.BlendCutout:
+		opacity, cutoff = material.Dissolve, material.AlphaCutoff
+	case common.BlendBlended:
+		opacity = material.Dissolve
+	}
+	shader.SetFloat("opacity", opacity)
+	shader.SetFloat("alphaCutoff", cutoff)
+}
+
+// uvTransform returns the -s and -o options of a texture map as a scale and
+// offset of texture coordinates. The diffuse map's are used for every map of
+// a material, since the shaders share one set of texture coordinates. A map
+// that was never set has a zero scale, which is taken as 1.
+func uvTransform(textureMap common.TextureMap) (scale, offset mgl32.Vec2) {
+	scale, offset = textureMap.Scale.Vec2(), textureMap.Offset.Vec2()
+	for i := range scale {
+		if scale[i] == 0 {
+			scale[i] = 1
+		}
+	}
+	return scale, offset
+}
+
+// QueueDraw adds a draw item to queue for every submesh of the level of
+// detail SelectLOD chose. Submeshes with a PBR material are drawn with
+// pbrShader, if it is set, and the rest with shader; the object's own Shader
+// replaces both.
+func (obj *RenderableObject) QueueDraw(queue *RenderQueue, shader, pbrShader *Shader, view mgl32.Mat4) {
+
+	ebo, submeshes := obj.EBO, obj.Submeshes
+	if obj.currentLOD >= 0 && obj.currentLOD < len(obj.LODs) {
+		lod := obj.LODs[obj.currentLOD]
+		ebo, submeshes = lod.EBO, lod.Submeshes
+	}
+
+	model := obj.ModelMatrix()
+	center := model.Mul4x1(obj.sphere.Center.Vec4(1))
+	depth := -view.Mul4x1(center).Z()
+
+	for _, submesh := range submeshes {
+		material := obj.Material[submesh.Material]
+
+		itemShader := shader
+		switch {
+		case obj.Shader != nil:
+			itemShader = obj.Shader
+		case pbrShader != nil && material != nil && material.PBR:
+			itemShader = pbrShader
+		}
+
+		queue.Add(DrawItem{
+			Object:   obj,
+			Shader:   itemShader,
+			Material: material,
+			Textures: obj.textures(submesh.Material),
+			EBO:      ebo,
+			Submesh:  submesh,
+			Model:    model,
+			Depth:    depth,
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package rendering
+
+import (
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"testing"
+)
+
+// queueItem returns a draw item tagged with id through its submesh offset,
+// so the order of a sorted list can be read back.
+func queueItem(id int, shader *Shader, material *common.Material, albedo uint32, depth float32) DrawItem {
+	item := DrawItem{Shader: shader, Material: material, Depth: depth}
+	item.Textures[AlbedoUnit] = albedo
+	item.Submesh.IndexOffset = id
+	return item
+}
+
+func queueOrder(items []DrawItem) []int {
+	ids := make([]int, len(items))
+	for i, item := range items {
+		ids[i] = item.Submesh.IndexOffset
+	}
+	return ids
+}
+
+func sameOrder(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRenderQueueOpaqueOrder(t *testing.T) {
+	lit, unlit := &Shader{Program: 1}, &Shader{Program: 2}
+	wood, stone := &common.Material{Name: "wood"}, &common.Material{Name: "stone"}
+	cutout := &common.Material{Name: "leaves", BlendMode: common.BlendCutout}
+
+	var q RenderQueue
+	// wood is seen before stone, so it sorts first whatever its address.
+	q.Add(queueItem(0, lit, wood, 7, 5))
+	q.Add(queueItem(1, unlit, wood, 1, 1))
+	q.Add(queueItem(2, lit, cutout, 1, 0))
+	q.Add(queueItem(3, lit, stone, 1, 0))
+	q.Add(queueItem(4, lit, wood, 3, 9))
+	q.Add(queueItem(5, lit, wood, 3, 2))
+	q.Add(queueItem(6, lit, nil, 9, 3))
+	q.Sort()
+
+	// Opaque before cutout, then by shader, material, texture and depth.
+	// The nil material is numbered after stone.
+	want := []int{5, 4, 0, 3, 6, 1, 2}
+	if got := queueOrder(q.Opaque); !sameOrder(got, want) {
+		t.Errorf("opaque order: got %v, want %v", got, want)
+	}
+	if len(q.Transparent) != 0 {
+		t.Errorf("got %d transparent items, want 0", len(q.Transparent))
+	}
+}
+
+func TestRenderQueueTransparentOrder(t *testing.T) {
+	shader := &Shader{Program: 1}
+	glass := &common.Material{Name: "glass", BlendMode: common.BlendBlended}
+	water := &common.Material{Name: "water", BlendMode: common.BlendBlended}
+
+	var q RenderQueue
+	q.Add(queueItem(0, shader, glass, 1, 2))
+	q.Add(queueItem(1, shader, water, 2, 8))
+	q.Add(queueItem(2, shader, glass, 1, 5))
+	q.Add(queueItem(3, shader, &common.Material{}, 1, 4))
+	q.Sort()
+
+	// Farthest first, ignoring shader, material and texture.
+	want := []int{1, 2, 0}
+	if got := queueOrder(q.Transparent); !sameOrder(got, want) {
+		t.Errorf("transparent order: got %v, want %v", got, want)
+	}
+	if got := queueOrder(q.Opaque); !sameOrder(got, []int{3}) {
+		t.Errorf("opaque order: got %v, want [3]", got)
+	}
+}
+
+func TestRenderQueueStable(t *testing.T) {
+	shader := &Shader{Program: 1}
+	wood := &common.Material{Name: "wood"}
+	glass := &common.Material{Name: "glass", BlendMode: common.BlendBlended}
+
+	var q RenderQueue
+	for i := 0; i < 8; i++ {
+		q.Add(queueItem(i, shader, wood, 1, 1))
+		q.Add(queueItem(100+i, shader, glass, 1, 1))
+	}
+
+	wantOpaque := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	wantTransparent := []int{100, 101, 102, 103, 104, 105, 106, 107}
+	for pass := 0; pass < 3; pass++ {
+		q.Sort()
+		if got := queueOrder(q.Opaque); !sameOrder(got, wantOpaque) {
+			t.Errorf("pass %d: opaque order: got %v, want %v", pass, got, wantOpaque)
+		}
+		if got := queueOrder(q.Transparent); !sameOrder(got, wantTransparent) {
+			t.Errorf("pass %d: transparent order: got %v, want %v", pass, got, wantTransparent)
+		}
+	}
+}
+
+func TestRenderQueueReset(t *testing.T) {
+	shader := &Shader{Program: 1}
+	first, second := &common.Material{Name: "first"}, &common.Material{Name: "second"}
+
+	var q RenderQueue
+	q.Add(queueItem(0, shader, first, 1, 0))
+	q.Reset()
+	if len(q.Opaque) != 0 || len(q.Transparent) != 0 {
+		t.Fatalf("got %d opaque and %d transparent items after Reset, want none", len(q.Opaque), len(q.Transparent))
+	}
+
+	// Material numbering starts over, so second now sorts before first.
+	q.Add(queueItem(1, shader, second, 1, 0))
+	q.Add(queueItem(2, shader, first, 1, 0))
+	q.Sort()
+	if got, want := queueOrder(q.Opaque), []int{1, 2}; !sameOrder(got, want) {
+		t.Errorf("opaque order: got %v, want %v", got, want)
+	}
+}
@@ -2,23 +2,50 @@ package rendering
 
 import (
 	"fmt"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
 	"github.com/UpsilonDiesBackwards/LibraryOfBabel/tools"
 	"github.com/go-gl/gl/v4.2-core/gl"
 	"github.com/go-gl/glfw/v3.2/glfw"
 	"github.com/go-gl/mathgl/mgl32"
+	"path/filepath"
 	"strings"
 	"time"
 )
 
 type Renderer struct {
-	Window  *Window
+	Window *Window
+	// Scene is the root of the tree Draw traverses. Objects indexes the
+	// objects in it by name.
+	Scene   *SceneNode
 	Objects map[string]*RenderableObject
 	Shader  *Shader
+	// PBRShader draws materials that use metallic-roughness shading.
+	PBRShader *Shader
 
+	// AmbientLight lights every surface evenly, standing in for the light
+	// bounced around the scene.
+	AmbientLight mgl32.Vec3
+
+	// Shadows controls the shadow maps of lights that cast shadows.
+	Shadows ShadowSettings
+
+	// Stats counts the objects of the last frame drawn by Draw.
+	Stats FrameStats
+
+	lights   []*Light
+	shadows  shadowState
+	queue    RenderQueue
 	project  mgl32.Mat4
 	lastTime time.Time
 }
 
+// FrameStats reports how many objects a frame drew and how many it skipped
+// because their bounds were outside the view frustum.
+type FrameStats struct {
+	Drawn  int
+	Culled int
+}
+
 func NewRenderer(window *Window) *Renderer {
 	if err := gl.Init(); err != nil {
 		panic(err)
@@ -40,29 +67,87 @@ func NewRenderer(window *Window) *Renderer {
 		fmt.Println("Error initializing OpenGL shader: ", err)
 	}
 
+	pbrShader, err := NewShader("res/shaders/shader.vert", "res/shaders/pbr.frag")
+	if err != nil {
+		fmt.Println("Error initializing PBR shader: ", err)
+	}
+
 	return &Renderer{
-		Window:   window,
-		Objects:  make(map[string]*RenderableObject),
-		Shader:   shader,
-		project:  projection,
-		lastTime: time.Now(),
+		Window:       window,
+		Scene:        NewSceneNode(""),
+		Objects:      make(map[string]*RenderableObject),
+		Shader:       shader,
+		PBRShader:    pbrShader,
+		AmbientLight: mgl32.Vec3{0.1, 0.1, 0.1},
+		Shadows:      DefaultShadowSettings(),
+		shadows:      newShadowState(),
+		project:      projection,
+		lastTime:     time.Now(),
 	}
 }
 
-func (r *Renderer) NewObject(filePath, mtlPath, name string) {
-	if mtlPath == "" {
-		mtlPath = strings.Replace(filePath, ".obj", ".mtl", 1)
+func (r *Renderer) NewObject(filePath, mtlPath, name string) error {
+	model, err := tools.LoadModel(filePath, mtlPath)
+	if err != nil {
+		return fmt.Errorf("failed to load model %s: %w", name, err)
 	}
 
-	model := tools.CreateNewOBJ(filePath, mtlPath)
+	if mtlPath == "" && model.Materials == nil {
+		if model.MaterialLib != "" {
+			mtlPath = model.MaterialLib
+		} else if strings.EqualFold(filepath.Ext(filePath), ".obj") {
+			mtlPath = strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".mtl"
+		}
+	}
 
 	renderableObject := NewRenderableObject(model, mtlPath)
 
 	r.AddNewObject(renderableObject, name)
+	return nil
+}
+
+// AddNewObject adds object at the top of the scene and indexes it by name.
+// An object already indexed by that name is removed with its children.
+func (r *Renderer) AddNewObject(object *RenderableObject, name string) *SceneNode {
+	return r.AddChildObject(r.Scene, object, name)
 }
 
-func (r *Renderer) AddNewObject(object *RenderableObject, name string) {
+// AddChildObject adds object to the scene below parent, so that it follows
+// parent's transform, and indexes it by name.
+func (r *Renderer) AddChildObject(parent *SceneNode, object *RenderableObject, name string) *SceneNode {
+	r.RemoveObject(name)
+
+	node := newObjectNode(name, object)
+	parent.AddChild(node)
 	r.Objects[name] = object
+	return node
+}
+
+// FindNode returns the node at a slash-separated path of names from the top
+// of the scene, such as "shelf/book", or nil.
+func (r *Renderer) FindNode(path string) *SceneNode {
+	return r.Scene.Find(path)
+}
+
+// RemoveObject removes the named object from the scene, along with every
+// node below it.
+func (r *Renderer) RemoveObject(name string) {
+	if object, ok := r.Objects[name]; ok && object.node != nil {
+		r.RemoveNode(object.node)
+	}
+	delete(r.Objects, name)
+}
+
+// RemoveNode detaches node and its subtree from the scene and drops their
+// objects from Objects.
+func (r *Renderer) RemoveNode(node *SceneNode) {
+	node.Detach()
+	node.Walk(func(n *SceneNode) bool {
+		if n.Object != nil && r.Objects[n.Name] == n.Object {
+			delete(r.Objects, n.Name)
+		}
+		return true
+	})
 }
 
 func (r *Renderer) GetObject(name string) *RenderableObject {
@@ -76,16 +161,42 @@ func (r *Renderer) GetObject(name string) *RenderableObject {
 func (r *Renderer) Draw(camera Camera) {
 	r.CalculateDeltaTime()
 
-	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
-
-	r.Shader.Use()
+	view := camera.GetTransform()
+	r.Scene.updateWorlds()
+	r.renderShadows(view)
 
-	r.Shader.SetMat4ByName("projection", r.project)
-	r.Shader.SetMat4ByName("view", camera.GetTransform())
+	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
 
-	for _, object := range r.Objects {
-		object.Draw(r.Shader)
-	}
+	frustum := common.NewFrustum(r.project.Mul4(view))
+	r.Stats = FrameStats{}
+	r.queue.Reset()
+
+	r.Scene.Walk(func(node *SceneNode) bool {
+		object := node.Object
+		if object == nil {
+			return true
+		}
+		if !object.InFrustum(frustum) {
+			r.Stats.Culled++
+			return true
+		}
+
+		object.SelectLOD(camera, r.project)
+		object.QueueDraw(&r.queue, r.Shader, r.PBRShader, view)
+		r.Stats.Drawn++
+		return true
+	})
+
+	r.queue.Sort()
+	eye := mgl32.Vec3{float32(camera.Position.X()), float32(camera.Position.Y()), float32(camera.Position.Z())}
+	r.queue.Submit(func(shader *Shader) {
+		shader.SetMat4ByName("projection", r.project)
+		shader.SetMat4ByName("view", view)
+		shader.SetVec3("viewPosition", eye)
+		shader.SetVec3("ambientLight", r.AmbientLight)
+		setLights(shader, r.lights, &r.shadows)
+		r.shadows.setShadows(shader, r.Shadows.PCFRadius)
+	})
 
 	r.Window.SwapBuffers()
 	glfw.PollEvents()
@@ -0,0 +1,227 @@
+package rendering
+
+import (
+	"errors"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"github.com/go-gl/mathgl/mgl32"
+	"strings"
+)
+
+// ErrSceneCycle is returned when a node would become its own ancestor.
+var ErrSceneCycle = errors.New("node cannot be a child of itself or its descendants")
+
+// SceneNode is a node of the scene tree. Its Transform is relative to its
+// parent, and the world matrix combining it with every ancestor is cached
+// until one of them changes. A node can hold a RenderableObject or only
+// group its children.
+type SceneNode struct {
+	Name      string
+	Transform *common.Transform
+	Object    *RenderableObject
+
+	parent   *SceneNode
+	children []*SceneNode
+
+	// world is valid while Transform and the parent's world matrix are at
+	// the versions it was computed from.
+	world              mgl32.Mat4
+	worldVersion       uint64
+	localVersion       uint64
+	parentWorldVersion uint64
+	parentSeen         *SceneNode
+}
+
+// NewSceneNode returns a node with an identity transform and no object.
+func NewSceneNode(name string) *SceneNode {
+	return &SceneNode{
+		Name:         name,
+		Transform:    common.NewTransform(),
+		world:        mgl32.Ident4(),
+		worldVersion: 1,
+	}
+}
+
+// newObjectNode returns a node for object that shares its Transform, so that
+// moving the object moves the node.
+func newObjectNode(name string, object *RenderableObject) *SceneNode {
+	node := NewSceneNode(name)
+	node.Transform = object.Transform
+	node.Object = object
+	node.world = object.Transform.Matrix()
+	node.localVersion = object.Transform.Version()
+	object.node = node
+	return node
+}
+
+func (n *SceneNode) Parent() *SceneNode {
+	return n.parent
+}
+
+// Children returns the node's children in drawing order. The slice must not
+// be modified.
+func (n *SceneNode) Children() []*SceneNode {
+	return n.children
+}
+
+// AddChild makes child the last child of n, detaching it from its current
+// parent. Its local transform is kept, so it moves with its new parent.
+func (n *SceneNode) AddChild(child *SceneNode) error {
+	for ancestor := n; ancestor != nil; ancestor = ancestor.parent {
+		if ancestor == child {
+			return ErrSceneCycle
+		}
+	}
+
+	child.Detach()
+	child.parent = n
+	n.children = append(n.children, child)
+	return nil
+}
+
+// SetParent moves n under parent. With keepWorld set, n's local transform is
+// changed so that it stays where it is in the world, as when picking up a
+// book and putting it on a shelf. A shear that the new parent's non-uniform
+// scale would need cannot be kept.
+func (n *SceneNode) SetParent(parent *SceneNode, keepWorld bool) error {
+	world := n.WorldMatrix()
+	if err := parent.AddChild(n); err != nil {
+		return err
+	}
+
+	if keepWorld {
+		local := parent.WorldMatrix().Inv().Mul4(world)
+		setFromMatrix(n.Transform, local)
+	}
+	return nil
+}
+
+// Detach removes n, and with it its subtree, from its parent.
+func (n *SceneNode) Detach() {
+	if n.parent == nil {
+		return
+	}
+
+	siblings := n.parent.children
+	for i, sibling := range siblings {
+		if sibling == n {
+			n.parent.children = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	n.parent = nil
+}
+
+// Find returns the descendant of n at a slash-separated path of names, such
+// as "shelf/book", or nil if there is none. When siblings share a name the
+// first one is followed.
+func (n *SceneNode) Find(path string) *SceneNode {
+	node := n
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+
+		var next *SceneNode
+		for _, child := range node.children {
+			if child.Name == name {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+// Path returns the names from the root to n, separated by slashes. The root
+// itself is not included.
+func (n *SceneNode) Path() string {
+	var names []string
+	for node := n; node.parent != nil; node = node.parent {
+		names = append(names, node.Name)
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return strings.Join(names, "/")
+}
+
+// Walk calls visit for n and every node below it, parents before children.
+// Returning false from visit skips that node's children.
+func (n *SceneNode) Walk(visit func(*SceneNode) bool) {
+	if !visit(n) {
+		return
+	}
+	for _, child := range n.children {
+		child.Walk(visit)
+	}
+}
+
+// WorldMatrix returns the matrix from n's space to the world, recomputing it
+// and those of its ancestors if any of their transforms changed.
+func (n *SceneNode) WorldMatrix() mgl32.Mat4 {
+	if n.parent != nil {
+		n.parent.WorldMatrix()
+	}
+	n.updateWorld()
+	return n.world
+}
+
+// updateWorld recomputes the world matrix if it is stale, assuming the
+// parent's is up to date.
+func (n *SceneNode) updateWorld() {
+	parentVersion := uint64(0)
+	if n.parent != nil {
+		parentVersion = n.parent.worldVersion
+	}
+	if n.localVersion == n.Transform.Version() && n.parentSeen == n.parent && n.parentWorldVersion == parentVersion {
+		return
+	}
+
+	n.world = n.Transform.Matrix()
+	if n.parent != nil {
+		n.world = n.parent.world.Mul4(n.world)
+	}
+	n.localVersion = n.Transform.Version()
+	n.parentSeen = n.parent
+	n.parentWorldVersion = parentVersion
+	n.worldVersion++
+}
+
+// updateWorlds brings the world matrices of n's subtree up to date, visiting
+// each node once.
+func (n *SceneNode) updateWorlds() {
+	n.updateWorld()
+	for _, child := range n.children {
+		child.updateWorlds()
+	}
+}
+
+// setFromMatrix splits an affine matrix without shear into t's translation,
+// rotation and scale.
+func setFromMatrix(t *common.Transform, matrix mgl32.Mat4) {
+	var scale mgl32.Vec3
+	rotation := mgl32.Ident4()
+	for column := 0; column < 3; column++ {
+		axis := matrix.Col(column).Vec3()
+		scale[column] = axis.Len()
+		if scale[column] != 0 {
+			axis = axis.Mul(1 / scale[column])
+		}
+		rotation.SetCol(column, axis.Vec4(0))
+	}
+
+	// A mirrored matrix is kept as a negative X scale, since a rotation
+	// cannot mirror.
+	if rotation.Det() < 0 {
+		scale[0] = -scale[0]
+		rotation.SetCol(0, rotation.Col(0).Mul(-1))
+	}
+
+	t.SetPosition(matrix.Col(3).Vec3())
+	t.SetRotation(mgl32.Mat4ToQuat(rotation))
+	t.SetScale(scale)
+}
@@ -0,0 +1,117 @@
+package rendering
+
+import (
+	"errors"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"testing"
+)
+
+func approxMat4(a, b mgl32.Mat4) bool {
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > 1e-5 {
+			return false
+		}
+	}
+	return true
+}
+
+// testTree returns root/shelf/book with the shelf at (0, 1, 0), turned a
+// quarter about Y and doubled in size, and the book at (1, 0, 0) on it.
+func testTree() (root, shelf, book *SceneNode) {
+	root, shelf, book = NewSceneNode("root"), NewSceneNode("shelf"), NewSceneNode("book")
+	shelf.Transform.SetPosition(mgl32.Vec3{0, 1, 0})
+	shelf.Transform.SetRotation(mgl32.QuatRotate(math.Pi/2, mgl32.Vec3{0, 1, 0}))
+	shelf.Transform.SetScale(mgl32.Vec3{2, 2, 2})
+	book.Transform.SetPosition(mgl32.Vec3{1, 0, 0})
+	root.AddChild(shelf)
+	shelf.AddChild(book)
+	return root, shelf, book
+}
+
+func TestSceneNodeCycles(t *testing.T) {
+	root, shelf, book := testTree()
+	tests := []struct {
+		name          string
+		parent, child *SceneNode
+	}{
+		{"itself", shelf, shelf},
+		{"its child", book, shelf},
+		{"its grandchild", book, root},
+	}
+	for _, test := range tests {
+		if err := test.parent.AddChild(test.child); !errors.Is(err, ErrSceneCycle) {
+			t.Errorf("%s: AddChild got %v, want ErrSceneCycle", test.name, err)
+		}
+		if err := test.child.SetParent(test.parent, true); !errors.Is(err, ErrSceneCycle) {
+			t.Errorf("%s: SetParent got %v, want ErrSceneCycle", test.name, err)
+		}
+	}
+
+	// A refused move leaves the tree as it was.
+	if book.Parent() != shelf || shelf.Parent() != root || root.Find("shelf/book") != book {
+		t.Errorf("tree changed after refused moves: %q", book.Path())
+	}
+}
+
+func TestSceneNodeWorldMatrix(t *testing.T) {
+	root, shelf, book := testTree()
+
+	// (1, 0, 0) is scaled to (2, 0, 0), turned to (0, 0, -2) and raised.
+	if got := book.WorldMatrix().Col(3).Vec3(); !approxVec3(got, mgl32.Vec3{0, 1, -2}) {
+		t.Errorf("book is at %v, want (0, 1, -2)", got)
+	}
+
+	// Moving an ancestor invalidates the cached matrices below it.
+	root.Transform.SetPosition(mgl32.Vec3{10, 0, 0})
+	if got := book.WorldMatrix().Col(3).Vec3(); !approxVec3(got, mgl32.Vec3{10, 1, -2}) {
+		t.Errorf("after moving the root the book is at %v, want (10, 1, -2)", got)
+	}
+	cached := book.WorldMatrix()
+	if version := book.worldVersion; book.WorldMatrix() != cached || book.worldVersion != version {
+		t.Error("world matrix recomputed without a change")
+	}
+
+	// Detaching makes the local transform the world one.
+	book.Detach()
+	if !approxMat4(book.WorldMatrix(), book.Transform.Matrix()) || len(shelf.Children()) != 0 {
+		t.Errorf("detached book has world matrix %v", book.WorldMatrix())
+	}
+}
+
+func TestSceneNodeSetParentKeepsWorld(t *testing.T) {
+	root, shelf, book := testTree()
+	table := NewSceneNode("table")
+	table.Transform.SetPosition(mgl32.Vec3{-3, 0, 4})
+	table.Transform.SetRotation(mgl32.QuatRotate(0.4, mgl32.Vec3{0, 0, 1}))
+	root.AddChild(table)
+
+	world := book.WorldMatrix()
+	if err := book.SetParent(table, true); err != nil {
+		t.Fatal(err)
+	}
+	if !approxMat4(book.WorldMatrix(), world) {
+		t.Errorf("world matrix changed from %v to %v", world, book.WorldMatrix())
+	}
+	if book.Path() != "table/book" || shelf.Find("book") != nil {
+		t.Errorf("book is at %q", book.Path())
+	}
+
+	// Without keepWorld the local transform stays and the book moves.
+	local := book.Transform.Matrix()
+	if err := book.SetParent(shelf, false); err != nil {
+		t.Fatal(err)
+	}
+	if book.Transform.Matrix() != local || !approxMat4(book.WorldMatrix(), shelf.WorldMatrix().Mul4(local)) {
+		t.Errorf("book moved to %v under the shelf", book.WorldMatrix())
+	}
+}
+
+func approxVec3(a, b mgl32.Vec3) bool {
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > 1e-5 {
+			return false
+		}
+	}
+	return true
+}
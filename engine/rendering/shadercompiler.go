@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"github.com/go-gl/gl/v4.2-core/gl"
 	"github.com/go-gl/mathgl/mgl32"
-
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 type Shader struct {
@@ -13,17 +14,31 @@ type Shader struct {
 }
 
 func NewShader(vPath, fPath string) (*Shader, error) {
+	return NewGeometryShader(vPath, "", fPath)
+}
+
+// NewGeometryShader builds a program with a geometry shader between the
+// vertex and fragment shaders. An empty gPath leaves it out.
+func NewGeometryShader(vPath, gPath, fPath string) (*Shader, error) {
 	vSource, err := loadSource(vPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load vertex source code: %v", err)
 	}
 
+	var gSource string
+	if gPath != "" {
+		gSource, err = loadSource(gPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load geometry source code: %v", err)
+		}
+	}
+
 	fSource, err := loadSource(fPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load fragment source code: %v", err)
 	}
 
-	program, err := createProgram(vSource, fSource)
+	program, err := createProgram(vSource, gSource, fSource)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create program: %v", err)
 	}
@@ -31,47 +46,105 @@ func NewShader(vPath, fPath string) (*Shader, error) {
 	return &Shader{Program: program}, nil
 }
 
+// loadSource reads a shader and the files it includes. A line of the form
+// #include "name" is replaced by the named file, found relative to the file
+// including it. Each file is included at most once, so shared files need no
+// include guards.
 func loadSource(path string) (string, error) {
+	var source strings.Builder
+	if err := includeSource(&source, path, make(map[string]bool)); err != nil {
+		return "", err
+	}
+	return source.String(), nil
+}
+
+func includeSource(source *strings.Builder, path string, included map[string]bool) error {
+	path = filepath.Clean(path)
+	if included[path] {
+		return nil
+	}
+	included[path] = true
+
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file %s: %w", path, err)
+		return fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		directive := strings.TrimSpace(line)
+		if !strings.HasPrefix(directive, "#include") {
+			source.WriteString(line)
+			if i < len(lines)-1 {
+				source.WriteByte('\n')
+			}
+			continue
+		}
+
+		name := strings.TrimSpace(strings.TrimPrefix(directive, "#include"))
+		if len(name) < 2 || name[0] != '"' || name[len(name)-1] != '"' {
+			return fmt.Errorf("%s:%d: malformed #include %s", path, i+1, name)
+		}
+		source.WriteString("#line 1\n")
+		if err := includeSource(source, filepath.Join(filepath.Dir(path), name[1:len(name)-1]), included); err != nil {
+			return err
+		}
+		// Compiler errors after the included text refer to the lines of
+		// this file again.
+		fmt.Fprintf(source, "\n#line %d\n", i+2)
 	}
-	return string(data), nil
+	return nil
 }
 
-func createProgram(vSource, fSource string) (uint32, error) {
-	vShader := gl.CreateShader(gl.VERTEX_SHADER)
-	vVertSource, free := gl.Strs(vSource + "\x00")
-	gl.ShaderSource(vShader, 1, vVertSource, nil)
-	gl.CompileShader(vShader)
-	free()
-	if err := verifyCompilation(vShader); err != nil {
+func createProgram(vSource, gSource, fSource string) (uint32, error) {
+	vShader, err := compileShader(gl.VERTEX_SHADER, vSource)
+	if err != nil {
 		return 0, err
 	}
+	shaders := []uint32{vShader}
+
+	if gSource != "" {
+		gShader, err := compileShader(gl.GEOMETRY_SHADER, gSource)
+		if err != nil {
+			return 0, err
+		}
+		shaders = append(shaders, gShader)
+	}
 
-	fShader := gl.CreateShader(gl.FRAGMENT_SHADER)
-	fVertSource, free := gl.Strs(fSource + "\x00")
-	gl.ShaderSource(fShader, 1, fVertSource, nil)
-	gl.CompileShader(fShader)
-	free()
-	if err := verifyCompilation(fShader); err != nil {
+	fShader, err := compileShader(gl.FRAGMENT_SHADER, fSource)
+	if err != nil {
 		return 0, err
 	}
+	shaders = append(shaders, fShader)
 
 	program := gl.CreateProgram()
-	gl.AttachShader(program, vShader)
-	gl.AttachShader(program, fShader)
+	for _, shader := range shaders {
+		gl.AttachShader(program, shader)
+	}
 	gl.LinkProgram(program)
 	if err := verifyProgramLink(program); err != nil {
 		return 0, err
 	}
 
-	gl.DeleteShader(vShader)
-	gl.DeleteShader(fShader)
+	for _, shader := range shaders {
+		gl.DeleteShader(shader)
+	}
 
 	return program, nil
 }
 
+func compileShader(shaderType uint32, source string) (uint32, error) {
+	shader := gl.CreateShader(shaderType)
+	csource, free := gl.Strs(source + "\x00")
+	gl.ShaderSource(shader, 1, csource, nil)
+	gl.CompileShader(shader)
+	free()
+	if err := verifyCompilation(shader); err != nil {
+		return 0, err
+	}
+	return shader, nil
+}
+
 func verifyCompilation(shader uint32) error {
 	var success int32
 	gl.GetShaderiv(shader, gl.COMPILE_STATUS, &success)
@@ -110,10 +183,22 @@ func (s *Shader) SetInt(name string, value int) {
 	gl.Uniform1i(gl.GetUniformLocation(s.Program, gl.Str(name+"\x00")), int32(value))
 }
 
+func (s *Shader) SetBool(name string, value bool) {
+	v := int32(0)
+	if value {
+		v = 1
+	}
+	gl.Uniform1i(gl.GetUniformLocation(s.Program, gl.Str(name+"\x00")), v)
+}
+
 func (s *Shader) SetFloat(name string, value float32) {
 	gl.Uniform1f(gl.GetUniformLocation(s.Program, gl.Str(name+"\x00")), value)
 }
 
+func (s *Shader) SetVec2(name string, value mgl32.Vec2) {
+	gl.Uniform2fv(gl.GetUniformLocation(s.Program, gl.Str(name+"\x00")), 1, &value[0])
+}
+
 func (s *Shader) SetVec3(name string, value mgl32.Vec3) {
 	gl.Uniform3fv(gl.GetUniformLocation(s.Program, gl.Str(name+"\x00")), 1, &value[0])
 }
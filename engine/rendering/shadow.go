@@ -0,0 +1,441 @@
+package rendering
+
+import (
+	"fmt"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"github.com/go-gl/gl/v4.2-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// MaxCascades is the largest number of cascades a directional light's
+// shadow can be split into.
+const MaxCascades = 4
+
+// MaxShadowMaps is the number of shadow map layers the lit shaders take. A
+// directional light uses one per cascade and a spot light one. Lights whose
+// maps would not fit cast no shadow, in the order they were added.
+const MaxShadowMaps = 16
+
+// shadowMapUnit is the texture unit the shadow maps are bound to, after the
+// material maps.
+const shadowMapUnit = TextureUnits
+
+// ShadowSettings controls the shadow maps of a Renderer.
+type ShadowSettings struct {
+	// MapSize is the width and height in texels of every shadow map.
+	MapSize int
+	// Cascades is the number of maps a directional light's shadow is split
+	// into along the view, nearest first, up to MaxCascades. Near cascades
+	// cover less of the scene and so give sharper shadows.
+	Cascades int
+	// SplitLambda places the cascade boundaries between evenly spaced (0)
+	// and logarithmic (1).
+	SplitLambda float32
+	// Distance is how far from the camera directional lights cast shadows,
+	// and how far spot lights without a Range do.
+	Distance float32
+	// PointShadows is how many shadow-casting point lights, nearest the
+	// camera first, get a cube map each frame, up to MaxPointShadows.
+	PointShadows int
+	// PointMapSize is the width and height in texels of each cube map face.
+	PointMapSize int
+	// PCFRadius is how many texels on each side of a lookup are averaged to
+	// soften shadow edges; 0 samples once.
+	PCFRadius int
+	// SlopeBias and ConstantBias are applied as a polygon offset while
+	// rendering depth, pushing surfaces seen at grazing angles further away.
+	// Point light cube maps write their own depth, which the offset does not
+	// reach.
+	SlopeBias    float32
+	ConstantBias float32
+}
+
+// DefaultShadowSettings returns the settings a new Renderer starts with.
+func DefaultShadowSettings() ShadowSettings {
+	return ShadowSettings{
+		MapSize:      2048,
+		Cascades:     4,
+		SplitLambda:  0.75,
+		Distance:     100,
+		PointShadows: 4,
+		PointMapSize: 512,
+		PCFRadius:    1,
+		SlopeBias:    2,
+		ConstantBias: 1,
+	}
+}
+
+// shadowView is one layer of the shadow map array: the depth seen from a
+// light, or from one cascade of a directional light.
+type shadowView struct {
+	viewProjection mgl32.Mat4
+	// texelSize is the size of a shadow map texel in world units. For spot
+	// lights it is the size one unit away from the light.
+	texelSize float32
+}
+
+// shadowState holds the shadow maps of a frame.
+type shadowState struct {
+	shader  *Shader
+	fbo     uint32
+	texture uint32
+	size    int
+	layers  int
+
+	views    []shadowView
+	splits   [MaxCascades]float32
+	cascades int
+
+	pointShader  *Shader
+	pointTexture uint32
+	pointSize    int
+	pointCubes   int
+	points       []pointShadow
+
+	// firstMap holds the first layer of each directional and spot light's
+	// maps, and the cube of each point light's.
+	firstMap map[*Light]int
+}
+
+// newShadowState loads the depth shaders. The shadows a shader draws are
+// disabled if it fails to build.
+func newShadowState() shadowState {
+	shader, err := NewShader("res/shaders/shadow.vert", "res/shaders/shadow.frag")
+	if err != nil {
+		fmt.Println("Error initializing shadow shader: ", err)
+	}
+
+	pointShader, err := NewGeometryShader("res/shaders/pointshadow.vert", "res/shaders/pointshadow.geom", "res/shaders/pointshadow.frag")
+	if err != nil {
+		fmt.Println("Error initializing point shadow shader: ", err)
+	}
+
+	return shadowState{shader: shader, pointShader: pointShader, firstMap: make(map[*Light]int)}
+}
+
+// renderShadows renders the shadow maps of every shadow-casting light for a
+// camera with the given view, and remembers them for setShadows.
+func (r *Renderer) renderShadows(view mgl32.Mat4) {
+	s := &r.shadows
+	s.views = s.views[:0]
+	s.points = s.points[:0]
+	for light := range s.firstMap {
+		delete(s.firstMap, light)
+	}
+
+	settings := r.Shadows
+	size := settings.MapSize
+	if size <= 0 {
+		size = DefaultShadowSettings().MapSize
+	}
+	s.cascades = settings.Cascades
+	if s.cascades < 1 {
+		s.cascades = 1
+	} else if s.cascades > MaxCascades {
+		s.cascades = MaxCascades
+	}
+
+	near, far := projectionDepthRange(r.project)
+	far = float32(math.Min(float64(far), float64(settings.Distance)))
+	cascadeNear := near
+	var cascadeCorners [MaxCascades][8]mgl32.Vec3
+	for c := 0; c < s.cascades; c++ {
+		s.splits[c] = cascadeSplit(near, far, settings.SplitLambda, c+1, s.cascades)
+		cascadeCorners[c] = frustumCorners(r.project, view, cascadeNear, s.splits[c])
+		cascadeNear = s.splits[c]
+	}
+
+	lights := r.lights
+	if len(lights) > MaxLights {
+		lights = lights[:MaxLights]
+	}
+	for _, light := range lights {
+		if !light.CastShadows || s.shader == nil {
+			continue
+		}
+
+		switch light.Type {
+		case DirectionalLight:
+			if len(s.views)+s.cascades > MaxShadowMaps {
+				continue
+			}
+			s.firstMap[light] = len(s.views)
+			for c := 0; c < s.cascades; c++ {
+				s.views = append(s.views, directionalShadowView(light, cascadeCorners[c], settings.Distance, size))
+			}
+		case SpotLight:
+			if len(s.views)+1 > MaxShadowMaps {
+				continue
+			}
+			s.firstMap[light] = len(s.views)
+			s.views = append(s.views, spotShadowView(light, settings.Distance, size))
+		}
+	}
+	if s.pointShader != nil {
+		eye := view.Inv().Col(3).Vec3()
+		s.selectPointShadows(lights, eye, settings.PointShadows, settings.Distance)
+	}
+	if len(s.views) == 0 && len(s.points) == 0 {
+		return
+	}
+
+	var viewport [4]int32
+	gl.GetIntegerv(gl.VIEWPORT, &viewport[0])
+	if s.fbo == 0 {
+		gl.GenFramebuffers(1, &s.fbo)
+		gl.BindFramebuffer(gl.FRAMEBUFFER, s.fbo)
+		gl.DrawBuffer(gl.NONE)
+		gl.ReadBuffer(gl.NONE)
+	}
+	gl.BindFramebuffer(gl.FRAMEBUFFER, s.fbo)
+
+	if len(s.views) > 0 {
+		s.allocate(size, len(s.views))
+		r.renderShadowViews(size)
+	}
+	if len(s.points) > 0 {
+		pointSize := settings.PointMapSize
+		if pointSize <= 0 {
+			pointSize = DefaultShadowSettings().PointMapSize
+		}
+		s.allocatePoints(pointSize, len(s.points))
+		r.renderPointShadows(pointSize)
+	}
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	gl.Viewport(viewport[0], viewport[1], viewport[2], viewport[3])
+}
+
+// renderShadowViews renders the layers of the shadow map array into the
+// bound framebuffer.
+func (r *Renderer) renderShadowViews(size int) {
+	s, settings := &r.shadows, r.Shadows
+	gl.Viewport(0, 0, int32(size), int32(size))
+	gl.Enable(gl.POLYGON_OFFSET_FILL)
+	gl.PolygonOffset(settings.SlopeBias, settings.ConstantBias)
+
+	s.shader.Use()
+	for unit, sampler := range textureSamplers {
+		s.shader.SetInt(sampler, unit)
+	}
+
+	for layer, shadow := range s.views {
+		gl.FramebufferTextureLayer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, s.texture, 0, int32(layer))
+		gl.Clear(gl.DEPTH_BUFFER_BIT)
+		s.shader.SetMat4ByName("lightSpace", shadow.viewProjection)
+
+		frustum := common.NewFrustum(shadow.viewProjection)
+		r.Scene.Walk(func(node *SceneNode) bool {
+			if object := node.Object; object != nil && object.CastShadows && object.InFrustum(frustum) {
+				object.drawDepth(s.shader)
+			}
+			return true
+		})
+	}
+
+	gl.Disable(gl.POLYGON_OFFSET_FILL)
+}
+
+// allocate makes sure the shadow map array has at least layers layers of
+// size by size texels. It only grows, so the count can change every frame.
+func (s *shadowState) allocate(size, layers int) {
+	if s.texture != 0 && s.size == size && s.layers >= layers {
+		return
+	}
+	if s.texture != 0 {
+		gl.DeleteTextures(1, &s.texture)
+	}
+
+	gl.GenTextures(1, &s.texture)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, s.texture)
+	gl.TexImage3D(gl.TEXTURE_2D_ARRAY, 0, gl.DEPTH_COMPONENT32F, int32(size), int32(size), int32(layers), 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
+	// Comparing in the sampler gives bilinear filtering of the comparison
+	// results for free.
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_COMPARE_MODE, gl.COMPARE_REF_TO_TEXTURE)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_COMPARE_FUNC, gl.LEQUAL)
+	// Anything outside a map is lit.
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_BORDER)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_BORDER)
+	border := [4]float32{1, 1, 1, 1}
+	gl.TexParameterfv(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_BORDER_COLOR, &border[0])
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, 0)
+
+	s.size, s.layers = size, layers
+}
+
+// setShadows binds the shadow maps of the frame and sets the uniforms the lit
+// shaders read them with.
+func (s *shadowState) setShadows(shader *Shader, pcfRadius int) {
+	// The samplers are given their own units even without maps, since
+	// samplers of different types may not share one.
+	shader.SetInt("shadowMaps", shadowMapUnit)
+	shader.SetInt("pointShadowMaps", pointShadowMapUnit)
+	shader.SetInt("pcfRadius", pcfRadius)
+
+	if len(s.points) > 0 {
+		gl.ActiveTexture(gl.TEXTURE0 + pointShadowMapUnit)
+		gl.BindTexture(gl.TEXTURE_CUBE_MAP_ARRAY, s.pointTexture)
+		for i, point := range s.points {
+			shader.SetFloat(fmt.Sprintf("pointShadowFars[%d]", i), point.far)
+		}
+	}
+	if len(s.views) == 0 {
+		gl.ActiveTexture(gl.TEXTURE0)
+		return
+	}
+
+	gl.ActiveTexture(gl.TEXTURE0 + shadowMapUnit)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, s.texture)
+	gl.ActiveTexture(gl.TEXTURE0)
+
+	for i, shadow := range s.views {
+		shader.SetMat4ByName(fmt.Sprintf("shadowMatrices[%d]", i), shadow.viewProjection)
+		shader.SetFloat(fmt.Sprintf("shadowTexelSizes[%d]", i), shadow.texelSize)
+	}
+	for c := 0; c < s.cascades; c++ {
+		shader.SetFloat(fmt.Sprintf("cascadeSplits[%d]", c), s.splits[c])
+	}
+	shader.SetInt("cascadeCount", s.cascades)
+}
+
+// shadowMap returns the first shadow map layer, or for a point light the
+// cube, of light in this frame, or -1 if it has none.
+func (s *shadowState) shadowMap(light *Light) int {
+	if layer, ok := s.firstMap[light]; ok {
+		return layer
+	}
+	return -1
+}
+
+// drawDepth draws the object's full mesh with the depth shader, whose
+// lightSpace matrix must already be set. Cutout materials are alpha tested
+// so that leaves and cobwebs cast holed shadows; blended ones are left out,
+// letting light through glass.
+func (obj *RenderableObject) drawDepth(shader *Shader) {
+	gl.BindVertexArray(obj.VAO)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, obj.EBO)
+	shader.SetMat4ByName("model", obj.ModelMatrix())
+
+	for _, submesh := range obj.Submeshes {
+		material := obj.Material[submesh.Material]
+		mode := blendMode(material)
+		if mode == common.BlendBlended {
+			continue
+		}
+
+		setMaterial(shader, material)
+		if mode == common.BlendCutout {
+			textures := obj.textures(submesh.Material)
+			gl.ActiveTexture(gl.TEXTURE0 + AlphaUnit)
+			gl.BindTexture(gl.TEXTURE_2D, textures[AlphaUnit])
+			gl.ActiveTexture(gl.TEXTURE0 + AlbedoUnit)
+			gl.BindTexture(gl.TEXTURE_2D, textures[AlbedoUnit])
+		}
+		gl.DrawElements(gl.TRIANGLES, int32(submesh.IndexCount), gl.UNSIGNED_INT, gl.PtrOffset(submesh.IndexOffset*4))
+	}
+	gl.BindVertexArray(0)
+}
+
+// projectionDepthRange returns the near and far planes of an OpenGL
+// perspective projection.
+func projectionDepthRange(projection mgl32.Mat4) (near, far float32) {
+	a, b := projection.At(2, 2), projection.At(2, 3)
+	return b / (a - 1), b / (a + 1)
+}
+
+// cascadeSplit returns the far distance of cascade index of count, blending
+// logarithmic and even spacing by lambda ("Parallel-Split Shadow Maps",
+// Zhang et al.).
+func cascadeSplit(near, far, lambda float32, index, count int) float32 {
+	fraction := float64(index) / float64(count)
+	logarithmic := float64(near) * math.Pow(float64(far/near), fraction)
+	uniform := float64(near) + float64(far-near)*fraction
+	return float32(float64(lambda)*logarithmic + float64(1-lambda)*uniform)
+}
+
+// frustumCorners returns the world space corners of the part of the view
+// frustum between the distances near and far in front of the camera.
+func frustumCorners(projection, view mgl32.Mat4, near, far float32) [8]mgl32.Vec3 {
+	inverse := projection.Mul4(view).Inv()
+	a, b := projection.At(2, 2), projection.At(2, 3)
+
+	var corners [8]mgl32.Vec3
+	for i, distance := range [2]float32{near, far} {
+		// The depth in normalized device coordinates of a point this far
+		// in front of the camera.
+		z := (b - a*distance) / distance
+		for j, xy := range [4][2]float32{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}} {
+			point := inverse.Mul4x1(mgl32.Vec4{xy[0], xy[1], z, 1})
+			corners[i*4+j] = point.Vec3().Mul(1 / point.W())
+		}
+	}
+	return corners
+}
+
+// directionalShadowView fits an orthographic map around the sphere through
+// the corners of one cascade. A sphere keeps the map's size fixed as the
+// camera turns, and snapping its centre to whole texels stops shadow edges
+// from crawling as the camera moves. Casters up to casterDistance beyond the
+// cascade towards the light are included.
+func directionalShadowView(light *Light, corners [8]mgl32.Vec3, casterDistance float32, size int) shadowView {
+	var center mgl32.Vec3
+	for _, corner := range corners {
+		center = center.Add(corner)
+	}
+	center = center.Mul(1.0 / 8)
+
+	radius := float32(0)
+	for _, corner := range corners {
+		radius = float32(math.Max(float64(radius), float64(corner.Sub(center).Len())))
+	}
+	radius = float32(math.Ceil(float64(radius)*16) / 16)
+
+	direction := light.Direction.Normalize()
+	up := shadowUp(direction)
+	texelSize := 2 * radius / float32(size)
+
+	rotation := mgl32.LookAtV(mgl32.Vec3{}, direction, up)
+	local := rotation.Mul4x1(center.Vec4(1))
+	local[0] = float32(math.Floor(float64(local[0]/texelSize))) * texelSize
+	local[1] = float32(math.Floor(float64(local[1]/texelSize))) * texelSize
+	center = rotation.Inv().Mul4x1(local).Vec3()
+
+	eye := center.Sub(direction.Mul(radius + casterDistance))
+	lightView := mgl32.LookAtV(eye, center, up)
+	projection := mgl32.Ortho(-radius, radius, -radius, radius, 0, 2*radius+casterDistance)
+
+	return shadowView{viewProjection: projection.Mul4(lightView), texelSize: texelSize}
+}
+
+// spotShadowNear is the near plane of spot light shadow maps. Casters closer
+// to the light than it cast no shadow.
+const spotShadowNear = 0.05
+
+// spotShadowView covers a spot light's cone with a perspective map.
+func spotShadowView(light *Light, distance float32, size int) shadowView {
+	far := light.Range
+	if far <= 0 {
+		far = distance
+	}
+	cone := mgl32.Clamp(light.OuterCone, mgl32.DegToRad(1), mgl32.DegToRad(85))
+
+	direction := light.Direction.Normalize()
+	lightView := mgl32.LookAtV(light.Position, light.Position.Add(direction), shadowUp(direction))
+	projection := mgl32.Perspective(2*cone, 1, float32(math.Min(spotShadowNear, float64(far)/2)), far)
+
+	return shadowView{
+		viewProjection: projection.Mul4(lightView),
+		texelSize:      2 * float32(math.Tan(float64(cone))) / float32(size),
+	}
+}
+
+// shadowUp returns an up vector for a light view along direction.
+func shadowUp(direction mgl32.Vec3) mgl32.Vec3 {
+	if math.Abs(float64(direction.Y())) > 0.99 {
+		return mgl32.Vec3{0, 0, 1}
+	}
+	return mgl32.Vec3{0, 1, 0}
+}
@@ -27,11 +27,17 @@ func main() {
 
 	rend := rendering.NewRenderer(window)
 
-	rend.NewObject("res/models/cube.obj", "", "char")
+	if err := rend.NewObject("res/models/cube.obj", "", "char"); err != nil {
+		fmt.Println(err)
+	}
 
 	rend.GetObject("char").SetPosition(mgl32.Vec3{0, -1, -4})
 	rend.GetObject("char").SetScale(mgl32.Vec3{1, 1, 1})
 
+	sun := rendering.NewDirectionalLight(mgl32.Vec3{-0.3, -1, -0.5}, mgl32.Vec3{1, 0.95, 0.9}, 1)
+	sun.CastShadows = true
+	rend.AddLight(sun)
+
 	var previousTime = time.Now()
 	for !window.ShouldClose() {
 		DeltaTime = CalculateDeltaTime(previousTime)
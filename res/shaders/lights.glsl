@@ -0,0 +1,56 @@
+// Lights set by the renderer, shared by the lit fragment shaders.
+
+#define MAX_LIGHTS 16
+
+#define DIRECTIONAL_LIGHT 0
+#define POINT_LIGHT 1
+#define SPOT_LIGHT 2
+
+struct Light {
+    int type;
+    vec3 position;
+    vec3 direction; // the way the light travels
+    vec3 color;     // already scaled by intensity
+    float range;    // 0 for no limit
+    vec3 attenuation; // constant, linear, quadratic
+    float innerCos;
+    float outerCos;
+    int shadowMap;    // layer in shadowMaps or cube in pointShadowMaps; -1 for none
+    float shadowBias;
+    float normalBias; // in shadow map texels
+};
+
+uniform Light lights[MAX_LIGHTS];
+uniform int lightCount;
+uniform vec3 ambientLight;
+uniform vec3 viewPosition;
+
+// falloff returns how much of a point or spot light reaches a fragment at
+// distance from it: the attenuation curve, faded smoothly to zero at range.
+float falloff(Light light, float lightDistance) {
+    vec3 a = light.attenuation;
+    float strength = 1.0 / max(a.x + a.y * lightDistance + a.z * lightDistance * lightDistance, 1e-4);
+    if (light.range > 0.0) {
+        float ratio = lightDistance / light.range;
+        strength *= pow(clamp(1.0 - ratio * ratio * ratio * ratio, 0.0, 1.0), 2.0);
+    }
+    return strength;
+}
+
+// lightVector returns the direction from position towards light, and in
+// strength the share of the light's colour that reaches it.
+vec3 lightVector(Light light, vec3 position, out float strength) {
+    strength = 1.0;
+    if (light.type == DIRECTIONAL_LIGHT) {
+        return -light.direction;
+    }
+
+    vec3 toLight = light.position - position;
+    float lightDistance = length(toLight);
+    vec3 L = toLight / max(lightDistance, 1e-4);
+    strength = falloff(light, lightDistance);
+    if (light.type == SPOT_LIGHT) {
+        strength *= smoothstep(light.outerCos, light.innerCos, dot(-L, light.direction));
+    }
+    return L;
+}
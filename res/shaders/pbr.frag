@@ -0,0 +1,131 @@
+#version 420
+#extension GL_ARB_explicit_uniform_location : enable
+
+#include "lights.glsl"
+#include "shadows.glsl"
+
+#define PI 3.14159265359
+
+layout (location = 0) out vec4 frag_colour;
+
+layout(location = 0) in vec2 TexCoord;
+layout(location = 1) in vec3 WorldPosition;
+layout(location = 2) in vec3 Normal;
+layout(location = 3) in vec4 Tangent;
+layout(location = 4) in float ViewDepth;
+
+uniform sampler2D texture0;
+uniform sampler2D alphaMap;
+uniform sampler2D normalMap;
+// glTF packs roughness in green and metalness in blue of one image; MTL
+// maps are greyscale, so the same channels read them too.
+uniform sampler2D roughnessMap;
+uniform sampler2D metallicMap;
+uniform sampler2D occlusionMap;
+uniform sampler2D emissiveMap;
+
+// The material's factors, which multiply its maps: Kd or baseColorFactor,
+// Pr, Pm, Ke and the normal map's -bm or scale.
+uniform vec3 diffuseColor = vec3(1.0);
+uniform float roughness = 1.0;
+uniform float metallic = 0.0;
+uniform vec3 emissiveColor = vec3(0.0);
+uniform float normalScale = 1.0;
+
+uniform float opacity = 1.0;
+uniform float alphaCutoff = 0.0;
+
+// distributionGGX is the share of microfacets facing along the half vector.
+float distributionGGX(float NdotH, float alpha) {
+    float alpha2 = alpha * alpha;
+    float d = NdotH * NdotH * (alpha2 - 1.0) + 1.0;
+    return alpha2 / (PI * d * d);
+}
+
+// geometrySmith is the share of microfacets neither shadowed nor masked by
+// others, with Schlick's approximation of Smith's function.
+float geometrySmith(float NdotV, float NdotL, float perceptualRoughness) {
+    float k = (perceptualRoughness + 1.0) * (perceptualRoughness + 1.0) / 8.0;
+    float gv = NdotV / (NdotV * (1.0 - k) + k);
+    float gl = NdotL / (NdotL * (1.0 - k) + k);
+    return gv * gl;
+}
+
+vec3 fresnelSchlick(float cosTheta, vec3 F0) {
+    return F0 + (1.0 - F0) * pow(clamp(1.0 - cosTheta, 0.0, 1.0), 5.0);
+}
+
+// surfaceNormal perturbs the interpolated normal by the normal map.
+vec3 surfaceNormal() {
+    vec3 N = normalize(Normal);
+    vec3 T = Tangent.xyz - N * dot(N, Tangent.xyz);
+    if (dot(T, T) < 1e-8) {
+        return N;
+    }
+    T = normalize(T);
+    vec3 B = cross(N, T) * (Tangent.w < 0.0 ? -1.0 : 1.0);
+
+    vec3 sampled = texture(normalMap, TexCoord).xyz * 2.0 - 1.0;
+    sampled.xy *= normalScale;
+    return normalize(mat3(T, B, N) * sampled);
+}
+
+void main() {
+    vec4 base = texture(texture0, TexCoord);
+    float alpha = base.a * texture(alphaMap, TexCoord).r * opacity;
+    if (alpha < alphaCutoff) {
+        discard;
+    }
+
+    // Colour textures are stored in sRGB; lighting is done in linear space.
+    vec3 albedo = pow(base.rgb, vec3(2.2)) * diffuseColor;
+    float perceptualRoughness = clamp(texture(roughnessMap, TexCoord).g * roughness, 0.04, 1.0);
+    float metalness = clamp(texture(metallicMap, TexCoord).b * metallic, 0.0, 1.0);
+    float occlusion = texture(occlusionMap, TexCoord).r;
+    vec3 emissive = pow(texture(emissiveMap, TexCoord).rgb, vec3(2.2)) * emissiveColor;
+
+    vec3 N = surfaceNormal();
+    if (!gl_FrontFacing) {
+        N = -N;
+    }
+    vec3 V = normalize(viewPosition - WorldPosition);
+    float NdotV = max(dot(N, V), 1e-4);
+
+    // Dielectrics reflect about 4% head on; metals tint reflections with
+    // their albedo and have no diffuse part.
+    vec3 F0 = mix(vec3(0.04), albedo, metalness);
+    float alphaRoughness = perceptualRoughness * perceptualRoughness;
+
+    vec3 radiance = vec3(0.0);
+    for (int i = 0; i < lightCount && i < MAX_LIGHTS; i++) {
+        float strength;
+        vec3 L = lightVector(lights[i], WorldPosition, strength);
+
+        float NdotL = max(dot(N, L), 0.0);
+        if (NdotL <= 0.0 || strength <= 0.0) {
+            continue;
+        }
+        strength *= shadowFactor(lights[i], WorldPosition, N, ViewDepth);
+        if (strength <= 0.0) {
+            continue;
+        }
+
+        vec3 H = normalize(L + V);
+        float NdotH = max(dot(N, H), 0.0);
+        vec3 F = fresnelSchlick(max(dot(H, V), 0.0), F0);
+
+        vec3 specular = distributionGGX(NdotH, alphaRoughness) * geometrySmith(NdotV, NdotL, perceptualRoughness) * F /
+            (4.0 * NdotV * NdotL + 1e-4);
+        vec3 diffuse = (1.0 - F) * (1.0 - metalness) * albedo / PI;
+
+        radiance += (diffuse + specular) * lights[i].color * strength * NdotL;
+    }
+
+    vec3 colour = ambientLight * albedo * occlusion + radiance + emissive;
+
+    // Reinhard tone mapping keeps highlights from clipping, then the result
+    // is encoded back to sRGB.
+    colour = colour / (colour + vec3(1.0));
+    colour = pow(colour, vec3(1.0 / 2.2));
+    frag_colour = vec4(colour, alpha);
+}
@@ -0,0 +1,24 @@
+#version 420
+
+// Writes the distance from the light over farPlane in place of depth, so
+// that lookups in any direction compare the same quantity.
+
+layout(location = 0) in vec2 TexCoord;
+layout(location = 1) in vec3 WorldPosition;
+
+uniform sampler2D texture0;
+uniform sampler2D alphaMap;
+
+uniform vec3 lightPosition;
+uniform float farPlane;
+
+uniform float opacity = 1.0;
+uniform float alphaCutoff = 0.0;
+
+void main() {
+    float alpha = texture(texture0, TexCoord).a * texture(alphaMap, TexCoord).r * opacity;
+    if (alpha < alphaCutoff) {
+        discard;
+    }
+    gl_FragDepth = length(WorldPosition - lightPosition) / farPlane;
+}
@@ -0,0 +1,16 @@
+#version 420
+
+layout(location = 0) in vec3 position;
+layout(location = 1) in vec2 texCoord;
+
+uniform mat4 model;
+
+uniform vec2 uvScale = vec2(1.0);
+uniform vec2 uvOffset = vec2(0.0);
+
+layout(location = 0) out vec2 VertexTexCoord;
+
+void main() {
+    VertexTexCoord = texCoord * uvScale + uvOffset;
+    gl_Position = model * vec4(position, 1.0);
+}
@@ -1,12 +1,62 @@
 #version 420
 #extension GL_ARB_explicit_uniform_location : enable
 
+#include "lights.glsl"
+#include "shadows.glsl"
+
 layout (location = 0) out vec4 frag_colour;
 
 layout(location = 0) in vec2 TexCoord;
+layout(location = 1) in vec3 WorldPosition;
+layout(location = 2) in vec3 Normal;
+layout(location = 4) in float ViewDepth;
 
 uniform sampler2D texture0;
+uniform sampler2D alphaMap;
+
+// Kd, Ks and Ns of the material.
+uniform vec3 diffuseColor = vec3(1.0);
+uniform vec3 specularColor = vec3(0.0);
+uniform float shininess = 1.0;
+
+// opacity scales the texture's alpha; fragments whose alpha ends up below
+// alphaCutoff are discarded. Opaque materials use 1 and 0.
+uniform float opacity = 1.0;
+uniform float alphaCutoff = 0.0;
 
 void main() {
-    frag_colour = texture(texture0, TexCoord);
+    vec4 albedo = texture(texture0, TexCoord);
+    albedo.a *= texture(alphaMap, TexCoord).r * opacity;
+    if (albedo.a < alphaCutoff) {
+        discard;
+    }
+
+    vec3 diffuse = albedo.rgb * diffuseColor;
+    vec3 N = normalize(Normal);
+    vec3 V = normalize(viewPosition - WorldPosition);
+    // Back faces of double-sided geometry are lit from their own side.
+    if (!gl_FrontFacing) {
+        N = -N;
+    }
+
+    vec3 colour = ambientLight * diffuse;
+    for (int i = 0; i < lightCount && i < MAX_LIGHTS; i++) {
+        float strength;
+        vec3 L = lightVector(lights[i], WorldPosition, strength);
+
+        float NdotL = max(dot(N, L), 0.0);
+        if (NdotL <= 0.0 || strength <= 0.0) {
+            continue;
+        }
+        strength *= shadowFactor(lights[i], WorldPosition, N, ViewDepth);
+        if (strength <= 0.0) {
+            continue;
+        }
+
+        vec3 H = normalize(L + V);
+        float specular = pow(max(dot(N, H), 0.0), shininess);
+        colour += lights[i].color * strength * (diffuse * NdotL + specularColor * specular);
+    }
+
+    frag_colour = vec4(colour, albedo.a);
 }
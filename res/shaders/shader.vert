@@ -4,14 +4,35 @@
 layout(location = 0) in vec3 position;
 layout(location = 1) in vec2 texCoord;
 layout(location = 2) in vec3 normal;
+layout(location = 3) in vec4 tangent;
 
 layout(location = 3) uniform mat4 projection;
 layout(location = 4) uniform mat4 view;
 layout(location = 5) uniform mat4 model;
 
+// The -s and -o options of the material's maps.
+uniform vec2 uvScale = vec2(1.0);
+uniform vec2 uvOffset = vec2(0.0);
+
 layout(location = 0) out vec2 TexCoord;
+layout(location = 1) out vec3 WorldPosition;
+layout(location = 2) out vec3 Normal;
+layout(location = 3) out vec4 Tangent;
+layout(location = 4) out float ViewDepth;
 
 void main() {
-    gl_Position = projection * view * model * vec4(position, 1.0);
-    TexCoord = texCoord;
+    vec4 worldPosition = model * vec4(position, 1.0);
+    vec4 viewSpace = view * worldPosition;
+    gl_Position = projection * viewSpace;
+
+    TexCoord = texCoord * uvScale + uvOffset;
+    WorldPosition = worldPosition.xyz;
+    // The distance in front of the camera picks the shadow cascade.
+    ViewDepth = -viewSpace.z;
+    // The inverse transpose keeps normals perpendicular under non-uniform
+    // scale.
+    Normal = transpose(inverse(mat3(model))) * normal;
+    // Tangents lie in the surface, so the model matrix itself moves them.
+    // w holds the handedness of the bitangent.
+    Tangent = vec4(mat3(model) * tangent.xyz, tangent.w);
 }
@@ -0,0 +1,19 @@
+#version 420
+
+// Only depth is written. Cutout materials discard the same fragments here as
+// when they are drawn, so their holes let light through.
+
+layout(location = 0) in vec2 TexCoord;
+
+uniform sampler2D texture0;
+uniform sampler2D alphaMap;
+
+uniform float opacity = 1.0;
+uniform float alphaCutoff = 0.0;
+
+void main() {
+    float alpha = texture(texture0, TexCoord).a * texture(alphaMap, TexCoord).r * opacity;
+    if (alpha < alphaCutoff) {
+        discard;
+    }
+}
@@ -0,0 +1,17 @@
+#version 420
+
+layout(location = 0) in vec3 position;
+layout(location = 1) in vec2 texCoord;
+
+uniform mat4 lightSpace;
+uniform mat4 model;
+
+uniform vec2 uvScale = vec2(1.0);
+uniform vec2 uvOffset = vec2(0.0);
+
+layout(location = 0) out vec2 TexCoord;
+
+void main() {
+    TexCoord = texCoord * uvScale + uvOffset;
+    gl_Position = lightSpace * model * vec4(position, 1.0);
+}
@@ -0,0 +1,112 @@
+// Shadow maps set by the renderer, shared by the lit fragment shaders.
+// Include after lights.glsl.
+
+#define MAX_SHADOW_MAPS 16
+#define MAX_CASCADES 4
+#define MAX_POINT_SHADOWS 4
+
+// One layer per spot light and one per cascade of a directional light.
+uniform sampler2DArrayShadow shadowMaps;
+uniform mat4 shadowMatrices[MAX_SHADOW_MAPS];
+// The size of a texel of each map in world units, or for spot lights its
+// size one unit from the light.
+uniform float shadowTexelSizes[MAX_SHADOW_MAPS];
+// The far distance from the camera of each cascade.
+uniform float cascadeSplits[MAX_CASCADES];
+uniform int cascadeCount = 1;
+// One cube per point light, holding distances from the light over its far
+// plane.
+uniform samplerCubeArrayShadow pointShadowMaps;
+uniform float pointShadowFars[MAX_POINT_SHADOWS];
+uniform int pcfRadius = 1;
+uniform bool receiveShadows = true;
+
+// pointShadowFactor is shadowFactor for point lights.
+float pointShadowFactor(Light light, vec3 position, vec3 normal) {
+    vec3 toPosition = position - light.position;
+    float lightDistance = length(toPosition);
+    float size = float(textureSize(pointShadowMaps, 0).x);
+    // A face spans 90 degrees, so a texel is 2 / size wide one unit from
+    // the light.
+    float texelSize = 2.0 * lightDistance / size;
+
+    vec3 L = -toPosition / max(lightDistance, 1e-4);
+    float slope = 1.0 - clamp(dot(normal, L), 0.0, 1.0);
+    toPosition += normal * (light.normalBias * texelSize * slope);
+
+    float reference = length(toPosition) / pointShadowFars[light.shadowMap] - light.shadowBias;
+    if (reference > 1.0) {
+        return 1.0;
+    }
+
+    // PCF samples a grid of texels across the direction of the lookup.
+    vec3 direction = normalize(toPosition);
+    vec3 up = abs(direction.y) < 0.99 ? vec3(0.0, 1.0, 0.0) : vec3(1.0, 0.0, 0.0);
+    vec3 T = normalize(cross(up, direction)) * (2.0 / size);
+    vec3 B = cross(direction, normalize(T)) * (2.0 / size);
+
+    float lit = 0.0;
+    int radius = max(pcfRadius, 0);
+    for (int x = -radius; x <= radius; x++) {
+        for (int y = -radius; y <= radius; y++) {
+            vec3 sampleDirection = direction + T * float(x) + B * float(y);
+            lit += texture(pointShadowMaps, vec4(sampleDirection, float(light.shadowMap)), reference);
+        }
+    }
+    float width = float(2 * radius + 1);
+    return lit / (width * width);
+}
+
+// shadowFactor returns the share of light that reaches position unblocked,
+// averaged over the shadow map texels around it. normal is the surface's,
+// and viewDepth its distance in front of the camera.
+float shadowFactor(Light light, vec3 position, vec3 normal, float viewDepth) {
+    if (!receiveShadows || light.shadowMap < 0) {
+        return 1.0;
+    }
+    if (light.type == POINT_LIGHT) {
+        return pointShadowFactor(light, position, normal);
+    }
+
+    int layer = light.shadowMap;
+    vec3 L = -light.direction;
+    float texelSize;
+    if (light.type == DIRECTIONAL_LIGHT) {
+        int count = clamp(cascadeCount, 1, MAX_CASCADES);
+        if (viewDepth > cascadeSplits[count - 1]) {
+            return 1.0;
+        }
+        int cascade = 0;
+        while (cascade < count - 1 && viewDepth > cascadeSplits[cascade]) {
+            cascade++;
+        }
+        layer += cascade;
+        texelSize = shadowTexelSizes[layer];
+    } else {
+        L = normalize(light.position - position);
+        texelSize = shadowTexelSizes[layer] * max(dot(position - light.position, light.direction), 0.0);
+    }
+
+    // Moving the lookup off the surface, further the more it faces away
+    // from the light, keeps it from shadowing itself.
+    float slope = 1.0 - clamp(dot(normal, L), 0.0, 1.0);
+    vec3 offsetPosition = position + normal * (light.normalBias * texelSize * slope);
+
+    vec4 lightSpace = shadowMatrices[layer] * vec4(offsetPosition, 1.0);
+    vec3 coords = lightSpace.xyz / lightSpace.w * 0.5 + 0.5;
+    if (coords.z > 1.0) {
+        return 1.0;
+    }
+    float reference = coords.z - light.shadowBias;
+
+    vec2 texel = 1.0 / vec2(textureSize(shadowMaps, 0).xy);
+    float lit = 0.0;
+    int radius = max(pcfRadius, 0);
+    for (int x = -radius; x <= radius; x++) {
+        for (int y = -radius; y <= radius; y++) {
+            lit += texture(shadowMaps, vec4(coords.xy + vec2(x, y) * texel, float(layer), reference));
+        }
+    }
+    float width = float(2 * radius + 1);
+    return lit / (width * width);
+}
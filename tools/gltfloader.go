@@ -0,0 +1,935 @@
+package tools
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var ErrInvalidGLTF = errors.New("invalid glTF")
+
+const (
+	glbMagic     = 0x46546C67 // "glTF"
+	glbChunkJSON = 0x4E4F534A // "JSON"
+	glbChunkBIN  = 0x004E4942 // "BIN\0"
+)
+
+const (
+	gltfByte          = 5120
+	gltfUnsignedByte  = 5121
+	gltfShort         = 5122
+	gltfUnsignedShort = 5123
+	gltfUnsignedInt   = 5125
+	gltfFloat         = 5126
+)
+
+const (
+	gltfTriangles     = 4
+	gltfTriangleStrip = 5
+	gltfTriangleFan   = 6
+)
+
+const gltfClampToEdge = 33071
+
+// gltfMaxImplicitCount caps the elements of an accessor without a buffer
+// view, which are zeros (or sparse values) that no data in the file backs.
+const gltfMaxImplicitCount = 1 << 24
+
+type gltfDocument struct {
+	Scene       *int             `json:"scene"`
+	Scenes      []gltfScene      `json:"scenes"`
+	Nodes       []gltfNode       `json:"nodes"`
+	Meshes      []gltfMesh       `json:"meshes"`
+	Accessors   []gltfAccessor   `json:"accessors"`
+	BufferViews []gltfBufferView `json:"bufferViews"`
+	Buffers     []gltfBuffer     `json:"buffers"`
+	Materials   []gltfMaterial   `json:"materials"`
+	Textures    []gltfTexture    `json:"textures"`
+	Images      []gltfImage      `json:"images"`
+	Samplers    []gltfSampler    `json:"samplers"`
+	Asset       struct {
+		Version string `json:"version"`
+	} `json:"asset"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type gltfNode struct {
+	Name        string       `json:"name"`
+	Children    []int        `json:"children"`
+	Mesh        *int         `json:"mesh"`
+	Matrix      *[16]float32 `json:"matrix"`
+	Translation *[3]float32  `json:"translation"`
+	Rotation    *[4]float32  `json:"rotation"`
+	Scale       *[3]float32  `json:"scale"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name"`
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices"`
+	Material   *int           `json:"material"`
+	Mode       *int           `json:"mode"`
+}
+
+type gltfAccessor struct {
+	BufferView    *int        `json:"bufferView"`
+	ByteOffset    int         `json:"byteOffset"`
+	ComponentType int         `json:"componentType"`
+	Normalized    bool        `json:"normalized"`
+	Count         int         `json:"count"`
+	Type          string      `json:"type"`
+	Sparse        *gltfSparse `json:"sparse"`
+}
+
+type gltfSparse struct {
+	Count   int `json:"count"`
+	Indices struct {
+		BufferView    int `json:"bufferView"`
+		ByteOffset    int `json:"byteOffset"`
+		ComponentType int `json:"componentType"`
+	} `json:"indices"`
+	Values struct {
+		BufferView int `json:"bufferView"`
+		ByteOffset int `json:"byteOffset"`
+	} `json:"values"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride"`
+}
+
+type gltfBuffer struct {
+	URI        string `json:"uri"`
+	ByteLength int    `json:"byteLength"`
+}
+
+type gltfTextureInfo struct {
+	Index    int     `json:"index"`
+	TexCoord int     `json:"texCoord"`
+	Scale    float32 `json:"scale"`
+	Strength float32 `json:"strength"`
+}
+
+type gltfMaterial struct {
+	Name                 string `json:"name"`
+	PBRMetallicRoughness *struct {
+		BaseColorFactor          *[4]float32      `json:"baseColorFactor"`
+		BaseColorTexture         *gltfTextureInfo `json:"baseColorTexture"`
+		MetallicFactor           *float32         `json:"metallicFactor"`
+		RoughnessFactor          *float32         `json:"roughnessFactor"`
+		MetallicRoughnessTexture *gltfTextureInfo `json:"metallicRoughnessTexture"`
+	} `json:"pbrMetallicRoughness"`
+	NormalTexture    *gltfTextureInfo `json:"normalTexture"`
+	OcclusionTexture *gltfTextureInfo `json:"occlusionTexture"`
+	EmissiveTexture  *gltfTextureInfo `json:"emissiveTexture"`
+	EmissiveFactor   *[3]float32      `json:"emissiveFactor"`
+	AlphaMode        string           `json:"alphaMode"`
+	AlphaCutoff      *float32         `json:"alphaCutoff"`
+}
+
+type gltfTexture struct {
+	Sampler *int `json:"sampler"`
+	Source  *int `json:"source"`
+}
+
+type gltfImage struct {
+	URI        string `json:"uri"`
+	BufferView *int   `json:"bufferView"`
+}
+
+type gltfSampler struct {
+	WrapS int `json:"wrapS"`
+	WrapT int `json:"wrapT"`
+}
+
+// gltfLoader holds a parsed document and its resolved buffers while the
+// scene is flattened into a single ObjectPrimitive.
+type gltfLoader struct {
+	filePath string
+	doc      gltfDocument
+	buffers  [][]byte
+
+	obj           *common.ObjectPrimitive
+	materialNames []string
+	hasTangents   bool
+}
+
+// CreateNewGLTF loads a glTF 2.0 model from a .gltf (JSON) or .glb (binary)
+// file. Every mesh instance in the default scene is transformed into model
+// space and merged, with each primitive becoming a submesh. The model's
+// materials are returned in ObjectPrimitive.Materials.
+func CreateNewGLTF(modelFPath string) (*common.ObjectPrimitive, error) {
+	data, err := os.ReadFile(modelFPath)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := &gltfLoader{filePath: modelFPath}
+
+	jsonChunk, binChunk := data, []byte(nil)
+	if len(data) >= 12 && binary.LittleEndian.Uint32(data) == glbMagic {
+		if jsonChunk, binChunk, err = splitGLB(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", modelFPath, err)
+		}
+	}
+
+	if err := json.Unmarshal(jsonChunk, &loader.doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", modelFPath, err)
+	}
+	if version := loader.doc.Asset.Version; !strings.HasPrefix(version, "2.") {
+		return nil, fmt.Errorf("%s: unsupported glTF version %q: %w", modelFPath, version, ErrInvalidGLTF)
+	}
+
+	if err := loader.loadBuffers(binChunk); err != nil {
+		return nil, fmt.Errorf("%s: %w", modelFPath, err)
+	}
+	if err := loader.build(); err != nil {
+		return nil, fmt.Errorf("%s: %w", modelFPath, err)
+	}
+	loader.obj.UpdateBounds()
+
+	return loader.obj, nil
+}
+
+// splitGLB returns the JSON and binary chunks of a GLB container.
+func splitGLB(data []byte) (jsonChunk, binChunk []byte, err error) {
+	if version := binary.LittleEndian.Uint32(data[4:]); version != 2 {
+		return nil, nil, fmt.Errorf("unsupported GLB version %d: %w", version, ErrInvalidGLTF)
+	}
+	length := int(binary.LittleEndian.Uint32(data[8:]))
+	if length > len(data) {
+		return nil, nil, fmt.Errorf("truncated GLB: %w", ErrInvalidGLTF)
+	}
+
+	offset := 12
+	for offset+8 <= length {
+		chunkLength := int(binary.LittleEndian.Uint32(data[offset:]))
+		chunkType := binary.LittleEndian.Uint32(data[offset+4:])
+		offset += 8
+		if offset+chunkLength > length {
+			return nil, nil, fmt.Errorf("truncated GLB chunk: %w", ErrInvalidGLTF)
+		}
+
+		switch chunkType {
+		case glbChunkJSON:
+			jsonChunk = data[offset : offset+chunkLength]
+		case glbChunkBIN:
+			if binChunk == nil {
+				binChunk = data[offset : offset+chunkLength]
+			}
+		}
+		offset += chunkLength
+	}
+
+	if jsonChunk == nil {
+		return nil, nil, fmt.Errorf("GLB has no JSON chunk: %w", ErrInvalidGLTF)
+	}
+	return jsonChunk, binChunk, nil
+}
+
+func (l *gltfLoader) loadBuffers(binChunk []byte) error {
+	l.buffers = make([][]byte, len(l.doc.Buffers))
+	for i, buffer := range l.doc.Buffers {
+		var data []byte
+		var err error
+
+		switch {
+		case buffer.URI == "" && i == 0 && binChunk != nil:
+			data = binChunk
+		case buffer.URI == "":
+			return fmt.Errorf("buffer %d has no data: %w", i, ErrInvalidGLTF)
+		default:
+			if data, err = l.readURI(buffer.URI); err != nil {
+				return fmt.Errorf("buffer %d: %w", i, err)
+			}
+		}
+
+		if len(data) < buffer.ByteLength {
+			return fmt.Errorf("buffer %d is shorter than its byteLength: %w", i, ErrInvalidGLTF)
+		}
+		l.buffers[i] = data
+	}
+	return nil
+}
+
+// readURI returns the contents of a data URI, or of a file referenced
+// relative to the model.
+func (l *gltfLoader) readURI(uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		comma := strings.IndexByte(uri, ',')
+		if comma < 0 || !strings.HasSuffix(uri[:comma], ";base64") {
+			return nil, fmt.Errorf("unsupported data URI: %w", ErrInvalidGLTF)
+		}
+		return base64.StdEncoding.DecodeString(uri[comma+1:])
+	}
+
+	path, err := url.PathUnescape(uri)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(ResolvePath(l.filePath, path, nil))
+}
+
+func (l *gltfLoader) build() error {
+	l.obj = &common.ObjectPrimitive{Materials: make(map[string]*common.Material)}
+	l.hasTangents = true
+
+	// Materials are looked up by name, so unnamed materials and repeated
+	// names are made unique with the material's index.
+	l.materialNames = make([]string, len(l.doc.Materials))
+	used := make(map[string]bool)
+	for i, material := range l.doc.Materials {
+		name := material.Name
+		if name == "" {
+			name = fmt.Sprintf("material#%d", i)
+		}
+		for used[name] {
+			name = fmt.Sprintf("%s#%d", name, i)
+		}
+		used[name] = true
+		l.materialNames[i] = name
+	}
+
+	for i := range l.doc.Materials {
+		material, err := l.material(i)
+		if err != nil {
+			return err
+		}
+		l.obj.Materials[material.Name] = material
+	}
+
+	var roots []int
+	switch {
+	case l.doc.Scene != nil && *l.doc.Scene >= 0 && *l.doc.Scene < len(l.doc.Scenes):
+		roots = l.doc.Scenes[*l.doc.Scene].Nodes
+	case len(l.doc.Scenes) > 0:
+		roots = l.doc.Scenes[0].Nodes
+	default:
+		// Without scenes every node that is nobody's child is a root.
+		isChild := make([]bool, len(l.doc.Nodes))
+		for _, node := range l.doc.Nodes {
+			for _, child := range node.Children {
+				if child >= 0 && child < len(isChild) {
+					isChild[child] = true
+				}
+			}
+		}
+		for i := range l.doc.Nodes {
+			if !isChild[i] {
+				roots = append(roots, i)
+			}
+		}
+	}
+
+	visited := make([]bool, len(l.doc.Nodes))
+	for _, root := range roots {
+		if err := l.visitNode(root, mgl32.Ident4(), visited); err != nil {
+			return err
+		}
+	}
+
+	// Tangents are only kept when every primitive supplied them, otherwise
+	// they are generated for the whole model later on.
+	if !l.hasTangents {
+		l.obj.Tangents = nil
+	}
+	return nil
+}
+
+func (l *gltfLoader) visitNode(index int, parent mgl32.Mat4, visited []bool) error {
+	if index < 0 || index >= len(l.doc.Nodes) {
+		return fmt.Errorf("node %d does not exist: %w", index, ErrInvalidGLTF)
+	}
+	if visited[index] {
+		return fmt.Errorf("node %d is part of a cycle: %w", index, ErrInvalidGLTF)
+	}
+	visited[index] = true
+
+	node := l.doc.Nodes[index]
+	world := parent.Mul4(nodeMatrix(node))
+
+	if node.Mesh != nil {
+		if *node.Mesh < 0 || *node.Mesh >= len(l.doc.Meshes) {
+			return fmt.Errorf("node %d references missing mesh %d: %w", index, *node.Mesh, ErrInvalidGLTF)
+		}
+		mesh := l.doc.Meshes[*node.Mesh]
+		name := mesh.Name
+		if name == "" {
+			name = node.Name
+		}
+
+		for p, primitive := range mesh.Primitives {
+			if err := l.appendPrimitive(name, primitive, world); err != nil {
+				return fmt.Errorf("mesh %d primitive %d: %w", *node.Mesh, p, err)
+			}
+		}
+	}
+
+	for _, child := range node.Children {
+		if err := l.visitNode(child, world, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func nodeMatrix(node gltfNode) mgl32.Mat4 {
+	if node.Matrix != nil {
+		return mgl32.Mat4(*node.Matrix) // both are column-major
+	}
+
+	matrix := mgl32.Ident4()
+	if t := node.Translation; t != nil {
+		matrix = mgl32.Translate3D(t[0], t[1], t[2])
+	}
+	if r := node.Rotation; r != nil {
+		matrix = matrix.Mul4(mgl32.Quat{W: r[3], V: mgl32.Vec3{r[0], r[1], r[2]}}.Normalize().Mat4())
+	}
+	if s := node.Scale; s != nil {
+		matrix = matrix.Mul4(mgl32.Scale3D(s[0], s[1], s[2]))
+	}
+	return matrix
+}
+
+func (l *gltfLoader) appendPrimitive(name string, primitive gltfPrimitive, world mgl32.Mat4) error {
+	mode := gltfTriangles
+	if primitive.Mode != nil {
+		mode = *primitive.Mode
+	}
+	if mode != gltfTriangles && mode != gltfTriangleStrip && mode != gltfTriangleFan {
+		return nil // points and lines are not drawn by the renderer
+	}
+
+	positionAccessor, ok := primitive.Attributes["POSITION"]
+	if !ok {
+		return fmt.Errorf("primitive has no POSITION: %w", ErrInvalidGLTF)
+	}
+	positions, err := l.readFloats(positionAccessor, 3)
+	if err != nil {
+		return err
+	}
+	vertexCount := len(positions) / 3
+
+	var normals, uvs, tangents []float32
+	if accessor, ok := primitive.Attributes["NORMAL"]; ok {
+		if normals, err = l.readFloats(accessor, 3); err != nil {
+			return err
+		}
+	}
+	if accessor, ok := primitive.Attributes["TEXCOORD_0"]; ok {
+		if uvs, err = l.readFloats(accessor, 2); err != nil {
+			return err
+		}
+	}
+	if accessor, ok := primitive.Attributes["TANGENT"]; ok {
+		if tangents, err = l.readFloats(accessor, 4); err != nil {
+			return err
+		}
+	}
+
+	var indices []uint32
+	if primitive.Indices != nil {
+		if indices, err = l.readIndices(*primitive.Indices); err != nil {
+			return err
+		}
+	} else {
+		indices = make([]uint32, vertexCount)
+		for i := range indices {
+			indices[i] = uint32(i)
+		}
+	}
+	for _, index := range indices {
+		if int(index) >= vertexCount {
+			return fmt.Errorf("index %d out of range: %w", index, ErrIndexOutOfRange)
+		}
+	}
+	indices = toTriangleList(indices, mode)
+
+	// glTF requires flat normals when none are given, which means every
+	// triangle needs its own corners.
+	if normals == nil {
+		positions, uvs, tangents, indices = unweld(positions, uvs, tangents, indices)
+		vertexCount = len(positions) / 3
+
+		corners := make([]int, len(indices))
+		cornerPositions := make([][3]float32, len(indices))
+		for i, index := range indices {
+			corners[i] = i
+			cornerPositions[i] = [3]float32{positions[index*3], positions[index*3+1], positions[index*3+2]}
+		}
+		flat := generateNormals(cornerPositions, corners, make([]uint32, len(indices)/3), true)
+
+		normals = make([]float32, vertexCount*3)
+		for i, index := range indices {
+			copy(normals[index*3:], flat[i][:])
+		}
+	}
+
+	if uvs == nil {
+		uvs = make([]float32, vertexCount*2)
+	}
+	if tangents == nil {
+		l.hasTangents = false
+	}
+
+	// Normals go through the inverse transpose so non-uniform scale does not
+	// skew them, and a mirroring transform flips the winding.
+	normalMatrix := world.Mat3().Inv().Transpose()
+	mirrored := world.Det() < 0
+
+	base := uint32(len(l.obj.Vertices) / 3)
+	for v := 0; v < vertexCount; v++ {
+		position := world.Mul4x1(mgl32.Vec4{positions[v*3], positions[v*3+1], positions[v*3+2], 1})
+		normal := normalMatrix.Mul3x1(mgl32.Vec3{normals[v*3], normals[v*3+1], normals[v*3+2]})
+		if normal.Len() > 0 {
+			normal = normal.Normalize()
+		}
+
+		l.obj.Vertices = append(l.obj.Vertices, position[0], position[1], position[2])
+		l.obj.Normals = append(l.obj.Normals, normal[0], normal[1], normal[2])
+
+		// glTF puts the UV origin at the top left of the image, which is
+		// also how LoadTexture uploads it, so UVs are used as they are.
+		l.obj.UVs = append(l.obj.UVs, uvs[v*2], uvs[v*2+1])
+
+		if tangents != nil {
+			tangent := world.Mat3().Mul3x1(mgl32.Vec3{tangents[v*4], tangents[v*4+1], tangents[v*4+2]})
+			if tangent.Len() > 0 {
+				tangent = tangent.Normalize()
+			}
+			w := tangents[v*4+3]
+			if mirrored {
+				w = -w
+			}
+			l.obj.Tangents = append(l.obj.Tangents, tangent[0], tangent[1], tangent[2], w)
+		} else {
+			l.obj.Tangents = append(l.obj.Tangents, 1, 0, 0, 1)
+		}
+	}
+
+	submesh := common.Submesh{
+		Name:        name,
+		IndexOffset: len(l.obj.Indices),
+		IndexCount:  len(indices) / 3 * 3,
+	}
+	if primitive.Material != nil && *primitive.Material >= 0 && *primitive.Material < len(l.doc.Materials) {
+		submesh.Material = l.materialName(*primitive.Material)
+	}
+
+	for t := 0; t+2 < len(indices); t += 3 {
+		if mirrored {
+			l.obj.Indices = append(l.obj.Indices, base+indices[t], base+indices[t+2], base+indices[t+1])
+		} else {
+			l.obj.Indices = append(l.obj.Indices, base+indices[t], base+indices[t+1], base+indices[t+2])
+		}
+	}
+	l.obj.Submeshes = append(l.obj.Submeshes, submesh)
+
+	return nil
+}
+
+// toTriangleList converts strip and fan indices to a plain triangle list.
+func toTriangleList(indices []uint32, mode int) []uint32 {
+	switch mode {
+	case gltfTriangleStrip:
+		var list []uint32
+		for i := 0; i+2 < len(indices); i++ {
+			if i%2 == 0 {
+				list = append(list, indices[i], indices[i+1], indices[i+2])
+			} else {
+				list = append(list, indices[i+1], indices[i], indices[i+2])
+			}
+		}
+		return list
+	case gltfTriangleFan:
+		var list []uint32
+		for i := 1; i+1 < len(indices); i++ {
+			list = append(list, indices[0], indices[i], indices[i+1])
+		}
+		return list
+	}
+	return indices
+}
+
+// unweld gives every index its own vertex.
+func unweld(positions, uvs, tangents []float32, indices []uint32) ([]float32, []float32, []float32, []uint32) {
+	var newPositions, newUVs, newTangents []float32
+	newIndices := make([]uint32, len(indices))
+
+	for i, index := range indices {
+		newPositions = append(newPositions, positions[index*3:index*3+3]...)
+		if uvs != nil {
+			newUVs = append(newUVs, uvs[index*2:index*2+2]...)
+		}
+		if tangents != nil {
+			newTangents = append(newTangents, tangents[index*4:index*4+4]...)
+		}
+		newIndices[i] = uint32(i)
+	}
+	return newPositions, newUVs, newTangents, newIndices
+}
+
+func (l *gltfLoader) materialName(index int) string {
+	return l.materialNames[index]
+}
+
+func (l *gltfLoader) material(index int) (*common.Material, error) {
+	source := l.doc.Materials[index]
+	material := common.NewMaterial(l.materialName(index))
+	material.Metallic = 1
+	material.PBR = true
+
+	var err error
+	if pbr := source.PBRMetallicRoughness; pbr != nil {
+		if c := pbr.BaseColorFactor; c != nil {
+			material.Diffuse = mgl32.Vec3{c[0], c[1], c[2]}
+			material.Dissolve = c[3]
+		}
+		if pbr.MetallicFactor != nil {
+			material.Metallic = *pbr.MetallicFactor
+		}
+		if pbr.RoughnessFactor != nil {
+			material.Roughness = *pbr.RoughnessFactor
+		}
+		if pbr.BaseColorTexture != nil {
+			if material.DiffuseMap, err = l.textureMap(pbr.BaseColorTexture); err != nil {
+				return nil, err
+			}
+		}
+		if pbr.MetallicRoughnessTexture != nil {
+			// Roughness is stored in green and metalness in blue of the
+			// same image.
+			if material.RoughnessMap, err = l.textureMap(pbr.MetallicRoughnessTexture); err != nil {
+				return nil, err
+			}
+			material.MetallicMap = material.RoughnessMap
+		}
+	}
+
+	if source.NormalTexture != nil {
+		if material.NormalMap, err = l.textureMap(source.NormalTexture); err != nil {
+			return nil, err
+		}
+		if source.NormalTexture.Scale != 0 {
+			material.NormalMap.BumpMultiplier = source.NormalTexture.Scale
+		}
+	}
+	if source.OcclusionTexture != nil {
+		if material.OcclusionMap, err = l.textureMap(source.OcclusionTexture); err != nil {
+			return nil, err
+		}
+	}
+	if source.EmissiveTexture != nil {
+		if material.EmissiveMap, err = l.textureMap(source.EmissiveTexture); err != nil {
+			return nil, err
+		}
+	}
+	if e := source.EmissiveFactor; e != nil {
+		material.Emissive = mgl32.Vec3{e[0], e[1], e[2]}
+	}
+
+	switch source.AlphaMode {
+	case "MASK":
+		material.BlendMode = common.BlendCutout
+	case "BLEND":
+		material.BlendMode = common.BlendBlended
+	}
+	if source.AlphaCutoff != nil {
+		material.AlphaCutoff = *source.AlphaCutoff
+	}
+
+	return material, nil
+}
+
+func (l *gltfLoader) textureMap(info *gltfTextureInfo) (common.TextureMap, error) {
+	textureMap := common.NewTextureMap("")
+	if info.Index < 0 || info.Index >= len(l.doc.Textures) {
+		return textureMap, fmt.Errorf("texture %d does not exist: %w", info.Index, ErrInvalidGLTF)
+	}
+	texture := l.doc.Textures[info.Index]
+
+	if texture.Sampler != nil && *texture.Sampler < len(l.doc.Samplers) {
+		sampler := l.doc.Samplers[*texture.Sampler]
+		textureMap.Clamp = sampler.WrapS == gltfClampToEdge && sampler.WrapT == gltfClampToEdge
+	}
+
+	if texture.Source == nil || *texture.Source < 0 || *texture.Source >= len(l.doc.Images) {
+		return textureMap, nil
+	}
+	image := l.doc.Images[*texture.Source]
+
+	switch {
+	case image.BufferView != nil:
+		data, err := l.bufferView(*image.BufferView)
+		if err != nil {
+			return textureMap, err
+		}
+		textureMap.Embedded = data
+	case strings.HasPrefix(image.URI, "data:"):
+		data, err := l.readURI(image.URI)
+		if err != nil {
+			return textureMap, err
+		}
+		textureMap.Embedded = data
+	case image.URI != "":
+		path, err := url.PathUnescape(image.URI)
+		if err != nil {
+			return textureMap, err
+		}
+		textureMap.Path = ResolvePath(l.filePath, path, nil)
+	}
+	return textureMap, nil
+}
+
+func (l *gltfLoader) bufferView(index int) ([]byte, error) {
+	if index < 0 || index >= len(l.doc.BufferViews) {
+		return nil, fmt.Errorf("buffer view %d does not exist: %w", index, ErrInvalidGLTF)
+	}
+	view := l.doc.BufferViews[index]
+	if view.Buffer < 0 || view.Buffer >= len(l.buffers) {
+		return nil, fmt.Errorf("buffer %d does not exist: %w", view.Buffer, ErrInvalidGLTF)
+	}
+
+	buffer := l.buffers[view.Buffer]
+	if view.ByteOffset < 0 || view.ByteLength < 0 || view.ByteStride < 0 || view.ByteOffset+view.ByteLength > len(buffer) {
+		return nil, fmt.Errorf("buffer view %d is out of bounds: %w", index, ErrInvalidGLTF)
+	}
+	return buffer[view.ByteOffset : view.ByteOffset+view.ByteLength], nil
+}
+
+var gltfComponentCounts = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+}
+
+var gltfComponentSizes = map[int]int{
+	gltfByte:          1,
+	gltfUnsignedByte:  1,
+	gltfShort:         2,
+	gltfUnsignedShort: 2,
+	gltfUnsignedInt:   4,
+	gltfFloat:         4,
+}
+
+// readFloats reads an accessor as floats, converting normalized integers and
+// applying sparse substitutions. The accessor must have exactly components
+// values per element.
+func (l *gltfLoader) readFloats(index, components int) ([]float32, error) {
+	if index < 0 || index >= len(l.doc.Accessors) {
+		return nil, fmt.Errorf("accessor %d does not exist: %w", index, ErrInvalidGLTF)
+	}
+	accessor := l.doc.Accessors[index]
+	if gltfComponentCounts[accessor.Type] != components {
+		return nil, fmt.Errorf("accessor %d has type %s, expected %d components: %w", index, accessor.Type, components, ErrInvalidGLTF)
+	}
+	if accessor.Count < 0 || accessor.ByteOffset < 0 {
+		return nil, fmt.Errorf("accessor %d has a negative count or offset: %w", index, ErrInvalidGLTF)
+	}
+	if sparse := accessor.Sparse; sparse != nil && (sparse.Count < 0 || sparse.Indices.ByteOffset < 0 || sparse.Values.ByteOffset < 0) {
+		return nil, fmt.Errorf("accessor %d has a negative sparse count or offset: %w", index, ErrInvalidGLTF)
+	}
+
+	var values []float32
+	if accessor.BufferView != nil {
+		var err error
+		values, err = l.readElements(*accessor.BufferView, accessor.ByteOffset, accessor.ComponentType, accessor.Normalized, components, accessor.Count)
+		if err != nil {
+			return nil, fmt.Errorf("accessor %d: %w", index, err)
+		}
+	} else {
+		// Without a buffer view nothing in the file backs the count, so it
+		// is capped before the zeros are allocated.
+		if accessor.Count > gltfMaxImplicitCount {
+			return nil, fmt.Errorf("accessor %d has %d elements but no bufferView: %w", index, accessor.Count, ErrInvalidGLTF)
+		}
+		values = make([]float32, accessor.Count*components)
+	}
+
+	if sparse := accessor.Sparse; sparse != nil {
+		if sparse.Count > accessor.Count {
+			return nil, fmt.Errorf("accessor %d has more sparse values than elements: %w", index, ErrInvalidGLTF)
+		}
+		targets, err := l.readUints(sparse.Indices.BufferView, sparse.Indices.ByteOffset, sparse.Indices.ComponentType, sparse.Count, true)
+		if err != nil {
+			return nil, fmt.Errorf("accessor %d sparse indices: %w", index, err)
+		}
+		replacements, err := l.readElements(sparse.Values.BufferView, sparse.Values.ByteOffset, accessor.ComponentType, accessor.Normalized, components, sparse.Count)
+		if err != nil {
+			return nil, fmt.Errorf("accessor %d sparse values: %w", index, err)
+		}
+
+		for i, target := range targets {
+			t := int(target)
+			if t >= accessor.Count {
+				return nil, fmt.Errorf("accessor %d sparse index %d: %w", index, t, ErrIndexOutOfRange)
+			}
+			copy(values[t*components:(t+1)*components], replacements[i*components:(i+1)*components])
+		}
+	}
+
+	return values, nil
+}
+
+// readIndices reads a scalar unsigned integer accessor without going through
+// floats, which cannot represent every 32-bit index.
+func (l *gltfLoader) readIndices(index int) ([]uint32, error) {
+	if index < 0 || index >= len(l.doc.Accessors) {
+		return nil, fmt.Errorf("accessor %d does not exist: %w", index, ErrInvalidGLTF)
+	}
+	accessor := l.doc.Accessors[index]
+	if accessor.Type != "SCALAR" || accessor.BufferView == nil || accessor.Sparse != nil {
+		return nil, fmt.Errorf("accessor %d is not an index accessor: %w", index, ErrInvalidGLTF)
+	}
+	if accessor.Count < 0 || accessor.ByteOffset < 0 {
+		return nil, fmt.Errorf("accessor %d has a negative count or offset: %w", index, ErrInvalidGLTF)
+	}
+
+	indices, err := l.readUints(*accessor.BufferView, accessor.ByteOffset, accessor.ComponentType, accessor.Count, false)
+	if err != nil {
+		return nil, fmt.Errorf("accessor %d: %w", index, err)
+	}
+	return indices, nil
+}
+
+// readUints decodes count unsigned integers from a buffer view. Packed views,
+// such as sparse index arrays, ignore the view's byteStride.
+func (l *gltfLoader) readUints(viewIndex, byteOffset, componentType, count int, packed bool) ([]uint32, error) {
+	data, err := l.bufferView(viewIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	var componentSize int
+	switch componentType {
+	case gltfUnsignedByte:
+		componentSize = 1
+	case gltfUnsignedShort:
+		componentSize = 2
+	case gltfUnsignedInt:
+		componentSize = 4
+	default:
+		return nil, fmt.Errorf("component type %d is not an index type: %w", componentType, ErrInvalidGLTF)
+	}
+
+	stride := componentSize
+	if view := l.doc.BufferViews[viewIndex]; view.ByteStride != 0 && !packed {
+		stride = view.ByteStride
+	}
+	if !fitsView(len(data), byteOffset, count, stride, componentSize) {
+		return nil, fmt.Errorf("data is out of bounds: %w", ErrInvalidGLTF)
+	}
+
+	values := make([]uint32, count)
+	for i := range values {
+		at := data[byteOffset+i*stride:]
+		switch componentSize {
+		case 1:
+			values[i] = uint32(at[0])
+		case 2:
+			values[i] = uint32(binary.LittleEndian.Uint16(at))
+		case 4:
+			values[i] = binary.LittleEndian.Uint32(at)
+		}
+	}
+	return values, nil
+}
+
+// readElements decodes count elements of the given number of components from
+// a buffer view. Integer components are converted to floats, normalized if
+// asked.
+func (l *gltfLoader) readElements(viewIndex, byteOffset, componentType int, normalized bool, components, count int) ([]float32, error) {
+	data, err := l.bufferView(viewIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	componentSize, ok := gltfComponentSizes[componentType]
+	if !ok {
+		return nil, fmt.Errorf("unknown component type %d: %w", componentType, ErrInvalidGLTF)
+	}
+
+	stride := componentSize * components
+	if view := l.doc.BufferViews[viewIndex]; view.ByteStride != 0 {
+		stride = view.ByteStride
+	}
+	if !fitsView(len(data), byteOffset, count, stride, componentSize*components) {
+		return nil, fmt.Errorf("data is out of bounds: %w", ErrInvalidGLTF)
+	}
+
+	out := make([]float32, count*components)
+	for i := 0; i < count; i++ {
+		for c := 0; c < components; c++ {
+			at := data[byteOffset+i*stride+c*componentSize:]
+			out[i*components+c] = readComponent(at, componentType, normalized)
+		}
+	}
+	return out, nil
+}
+
+// fitsView reports whether count elements of size bytes, stride bytes apart
+// from byteOffset, lie within a view of length bytes. It divides rather than
+// multiplies so that counts from the file cannot overflow.
+func fitsView(length, byteOffset, count, stride, size int) bool {
+	if count < 0 || byteOffset < 0 || stride <= 0 || byteOffset > length {
+		return false
+	}
+	if count == 0 {
+		return true
+	}
+	room := length - byteOffset - size
+	return room >= 0 && count-1 <= room/stride
+}
+
+func readComponent(data []byte, componentType int, normalized bool) float32 {
+	switch componentType {
+	case gltfFloat:
+		return math.Float32frombits(binary.LittleEndian.Uint32(data))
+	case gltfByte:
+		value := float32(int8(data[0]))
+		if normalized {
+			return float32(math.Max(float64(value/127), -1))
+		}
+		return value
+	case gltfUnsignedByte:
+		value := float32(data[0])
+		if normalized {
+			return value / 255
+		}
+		return value
+	case gltfShort:
+		value := float32(int16(binary.LittleEndian.Uint16(data)))
+		if normalized {
+			return float32(math.Max(float64(value/32767), -1))
+		}
+		return value
+	case gltfUnsignedShort:
+		value := float32(binary.LittleEndian.Uint16(data))
+		if normalized {
+			return value / 65535
+		}
+		return value
+	case gltfUnsignedInt:
+		return float32(binary.LittleEndian.Uint32(data))
+	}
+	return 0
+}
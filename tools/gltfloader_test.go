@@ -0,0 +1,225 @@
+package tools
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// testGLTF returns a glTF document with one triangle primitive for each
+// entry of materials, all sharing a single position accessor.
+func testGLTF(materials ...string) map[string]any {
+	positions := make([]byte, 0, 36)
+	for _, value := range []float32{0, 0, 0, 1, 0, 0, 0, 1, 0} {
+		positions = binary.LittleEndian.AppendUint32(positions, math.Float32bits(value))
+	}
+
+	var primitives, gltfMaterials []any
+	for i, name := range materials {
+		primitives = append(primitives, map[string]any{"attributes": map[string]any{"POSITION": 0}, "material": i})
+		gltfMaterials = append(gltfMaterials, map[string]any{"name": name})
+	}
+
+	return map[string]any{
+		"asset":       map[string]any{"version": "2.0"},
+		"nodes":       []any{map[string]any{"mesh": 0}},
+		"meshes":      []any{map[string]any{"primitives": primitives}},
+		"materials":   gltfMaterials,
+		"accessors":   []any{map[string]any{"bufferView": 0, "componentType": gltfFloat, "count": 3, "type": "VEC3"}},
+		"bufferViews": []any{map[string]any{"buffer": 0, "byteLength": len(positions)}},
+		"buffers": []any{map[string]any{
+			"byteLength": len(positions),
+			"uri":        "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(positions),
+		}},
+	}
+}
+
+func writeGLTF(t *testing.T, doc map[string]any) string {
+	t.Helper()
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeTestFile(t, "model.gltf", string(data))
+}
+
+func TestGLTFMaterialNames(t *testing.T) {
+	path := writeGLTF(t, testGLTF("paint", "", "paint", "material#1"))
+	obj, err := CreateNewGLTF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(obj.Materials) != 4 {
+		t.Errorf("got %d materials, want 4", len(obj.Materials))
+	}
+	if len(obj.Submeshes) != 4 {
+		t.Fatalf("got %d submeshes, want 4", len(obj.Submeshes))
+	}
+	seen := make(map[string]bool)
+	for i, submesh := range obj.Submeshes {
+		if seen[submesh.Material] {
+			t.Errorf("submesh %d shares material %q with an earlier one", i, submesh.Material)
+		}
+		seen[submesh.Material] = true
+		if obj.Materials[submesh.Material] == nil {
+			t.Errorf("submesh %d uses material %q, which was not loaded", i, submesh.Material)
+		}
+	}
+	if obj.Submeshes[0].Material != "paint" {
+		t.Errorf("first material renamed to %q", obj.Submeshes[0].Material)
+	}
+}
+
+func TestGLTFRejectsNegativeLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(doc map[string]any)
+	}{
+		{"accessor byteOffset", func(doc map[string]any) { doc["accessors"].([]any)[0].(map[string]any)["byteOffset"] = -12 }},
+		{"accessor count", func(doc map[string]any) { doc["accessors"].([]any)[0].(map[string]any)["count"] = -3 }},
+		{"bufferView byteOffset", func(doc map[string]any) { doc["bufferViews"].([]any)[0].(map[string]any)["byteOffset"] = -12 }},
+		{"bufferView byteLength", func(doc map[string]any) { doc["bufferViews"].([]any)[0].(map[string]any)["byteLength"] = -1 }},
+		{"bufferView byteStride", func(doc map[string]any) { doc["bufferViews"].([]any)[0].(map[string]any)["byteStride"] = -12 }},
+		{"scene index", func(doc map[string]any) {
+			doc["scenes"] = []any{map[string]any{"nodes": []any{-1}}}
+			doc["scene"] = 0
+		}},
+	}
+
+	for _, test := range tests {
+		doc := testGLTF("paint")
+		test.damage(doc)
+		if _, err := CreateNewGLTF(writeGLTF(t, doc)); !errors.Is(err, ErrInvalidGLTF) {
+			t.Errorf("%s: got %v, want ErrInvalidGLTF", test.name, err)
+		}
+	}
+}
+
+func TestGLTFRejectsHostileCounts(t *testing.T) {
+	accessor := func(doc map[string]any) map[string]any { return doc["accessors"].([]any)[0].(map[string]any) }
+	sparse := func(count int) map[string]any {
+		return map[string]any{
+			"count":   count,
+			"indices": map[string]any{"bufferView": 0, "componentType": gltfUnsignedInt},
+			"values":  map[string]any{"bufferView": 0},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		damage func(doc map[string]any)
+	}{
+		{"overflowing count", func(doc map[string]any) { accessor(doc)["count"] = 4611686018427387904 }},
+		{"count past the view", func(doc map[string]any) { accessor(doc)["count"] = 1 << 40 }},
+		{"overflowing offset", func(doc map[string]any) { accessor(doc)["byteOffset"] = 9223372036854775800 }},
+		{"overflowing stride", func(doc map[string]any) {
+			accessor(doc)["count"] = 3
+			doc["bufferViews"].([]any)[0].(map[string]any)["byteStride"] = 4611686018427387904
+		}},
+		{"count without a view", func(doc map[string]any) {
+			delete(accessor(doc), "bufferView")
+			accessor(doc)["count"] = 1 << 40
+		}},
+		{"overflowing count without a view", func(doc map[string]any) {
+			delete(accessor(doc), "bufferView")
+			accessor(doc)["count"] = 4611686018427387904
+		}},
+		{"sparse count past the view", func(doc map[string]any) {
+			delete(accessor(doc), "bufferView")
+			accessor(doc)["count"] = 1 << 20
+			accessor(doc)["sparse"] = sparse(1 << 19)
+		}},
+		{"sparse count above the accessor's", func(doc map[string]any) { accessor(doc)["sparse"] = sparse(4) }},
+	}
+
+	for _, test := range tests {
+		doc := testGLTF("paint")
+		test.damage(doc)
+		if _, err := CreateNewGLTF(writeGLTF(t, doc)); !errors.Is(err, ErrInvalidGLTF) {
+			t.Errorf("%s: got %v, want ErrInvalidGLTF", test.name, err)
+		}
+	}
+}
+
+// packGLB wraps doc and bin in a GLB container.
+func packGLB(t *testing.T, doc map[string]any, bin []byte) string {
+	t.Helper()
+	jsonChunk, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(jsonChunk)%4 != 0 {
+		jsonChunk = append(jsonChunk, ' ')
+	}
+	for len(bin)%4 != 0 {
+		bin = append(bin, 0)
+	}
+
+	data := binary.LittleEndian.AppendUint32(nil, glbMagic)
+	data = binary.LittleEndian.AppendUint32(data, 2)
+	data = binary.LittleEndian.AppendUint32(data, uint32(12+8+len(jsonChunk)+8+len(bin)))
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(jsonChunk)))
+	data = binary.LittleEndian.AppendUint32(data, glbChunkJSON)
+	data = append(data, jsonChunk...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(bin)))
+	data = binary.LittleEndian.AppendUint32(data, glbChunkBIN)
+	data = append(data, bin...)
+	return writeTestFile(t, "model.glb", string(data))
+}
+
+func TestGLTFBinaryContainer(t *testing.T) {
+	var bin []byte
+	for _, value := range []float32{0, 0, 0, 1, 0, 0, 1, 1, 0, 0, 1, 0} {
+		bin = binary.LittleEndian.AppendUint32(bin, math.Float32bits(value))
+	}
+	for _, index := range []uint16{0, 1, 2, 0, 2, 3} {
+		bin = binary.LittleEndian.AppendUint16(bin, index)
+	}
+
+	doc := map[string]any{
+		"asset":  map[string]any{"version": "2.0"},
+		"scene":  0,
+		"scenes": []any{map[string]any{"nodes": []any{0}}},
+		"nodes": []any{
+			map[string]any{"translation": []float32{0, 0, 5}, "children": []any{1}},
+			map[string]any{"scale": []float32{2, 2, 2}, "mesh": 0},
+		},
+		"meshes": []any{map[string]any{"name": "quad", "primitives": []any{map[string]any{
+			"attributes": map[string]any{"POSITION": 0},
+			"indices":    1,
+		}}}},
+		"accessors": []any{
+			map[string]any{"bufferView": 0, "componentType": gltfFloat, "count": 4, "type": "VEC3"},
+			map[string]any{"bufferView": 1, "componentType": gltfUnsignedShort, "count": 6, "type": "SCALAR"},
+		},
+		"bufferViews": []any{
+			map[string]any{"buffer": 0, "byteLength": 48},
+			map[string]any{"buffer": 0, "byteOffset": 48, "byteLength": 12},
+		},
+		"buffers": []any{map[string]any{"byteLength": len(bin)}},
+	}
+
+	obj, err := CreateNewGLTF(packGLB(t, doc, bin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(obj.Indices) != 6 || len(obj.Submeshes) != 1 || obj.Submeshes[0].Name != "quad" {
+		t.Fatalf("got %d indices and submeshes %v", len(obj.Indices), obj.Submeshes)
+	}
+	positions, _, _ := objCorners(obj)
+	want := [][3]float32{{0, 0, 5}, {2, 0, 5}, {2, 2, 5}, {0, 0, 5}, {2, 2, 5}, {0, 2, 5}}
+	if !reflect.DeepEqual(positions, want) {
+		t.Errorf("positions %v, want %v", positions, want)
+	}
+
+	// A node that is its own descendant is rejected.
+	doc["nodes"].([]any)[1].(map[string]any)["children"] = []any{0}
+	if _, err := CreateNewGLTF(packGLB(t, doc, bin)); !errors.Is(err, ErrInvalidGLTF) {
+		t.Errorf("cycle: got %v, want ErrInvalidGLTF", err)
+	}
+}
@@ -0,0 +1,77 @@
+package tools
+
+import "github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+
+// meshBuilder assembles an ObjectPrimitive from individual vertices, merging
+// vertices whose position, UV and normal are all identical.
+type meshBuilder struct {
+	obj       *common.ObjectPrimitive
+	vertexMap map[Vertex]uint32
+}
+
+func newMeshBuilder() *meshBuilder {
+	return &meshBuilder{
+		obj:       &common.ObjectPrimitive{},
+		vertexMap: make(map[Vertex]uint32),
+	}
+}
+
+// add returns the index of vertex, appending it if it has not been seen.
+func (b *meshBuilder) add(vertex Vertex) uint32 {
+	if index, found := b.vertexMap[vertex]; found {
+		return index
+	}
+
+	index := uint32(len(b.obj.Vertices) / 3)
+	b.obj.Vertices = append(b.obj.Vertices, vertex.Position[:]...)
+	b.obj.UVs = append(b.obj.UVs, vertex.UV[:]...)
+	b.obj.Normals = append(b.obj.Normals, vertex.Normal[:]...)
+	b.vertexMap[vertex] = index
+	return index
+}
+
+// addTriangle appends a triangle, dropping it if merging vertices has
+// collapsed two of its corners together.
+func (b *meshBuilder) addTriangle(v0, v1, v2 uint32) {
+	if v0 == v1 || v1 == v2 || v2 == v0 {
+		return
+	}
+	b.obj.Indices = append(b.obj.Indices, v0, v1, v2)
+}
+
+// generateSmoothNormals replaces the normals of obj with smooth ones.
+// Vertices at the same position share a normal even when they were split
+// for differing UVs.
+func generateSmoothNormals(obj *common.ObjectPrimitive) {
+	var positions [][3]float32
+	welded := make(map[[3]float32]int)
+	vertexPosition := make([]int, len(obj.Vertices)/3)
+
+	for v := range vertexPosition {
+		position := [3]float32{obj.Vertices[v*3], obj.Vertices[v*3+1], obj.Vertices[v*3+2]}
+		index, found := welded[position]
+		if !found {
+			index = len(positions)
+			positions = append(positions, position)
+			welded[position] = index
+		}
+		vertexPosition[v] = index
+	}
+
+	triangleCount := len(obj.Indices) / 3
+	corners := make([]int, triangleCount*3)
+	for i := range corners {
+		corners[i] = vertexPosition[obj.Indices[i]]
+	}
+
+	groups := make([]uint32, triangleCount)
+	for i := range groups {
+		groups[i] = 1
+	}
+	normals := generateNormals(positions, corners, groups, false)
+
+	obj.Normals = make([]float32, len(obj.Vertices))
+	for i, normal := range normals {
+		copy(obj.Normals[obj.Indices[i]*3:], normal[:])
+	}
+}
@@ -0,0 +1,231 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// MeshCacheExt is the file extension of the binary mesh cache format.
+const MeshCacheExt = ".lbmesh"
+
+// MeshCacheVersion is bumped whenever the layout below changes; older caches
+// are rejected and have to be converted again.
+const MeshCacheVersion = 1
+
+var meshCacheMagic = [8]byte{'L', 'O', 'B', 'M', 'E', 'S', 'H', 0}
+
+var ErrInvalidMeshCache = errors.New("invalid mesh cache")
+
+// meshCacheHeader starts every cache file. All values are little-endian.
+// The header is followed by the payload, whose CRC-32 (Castagnoli) is stored
+// in Checksum:
+//
+//	material library path  MaterialLibLength bytes, relative to the cache file
+//	submesh table          SubmeshCount entries of
+//	                         uint32 name length, name bytes,
+//	                         uint32 material length, material bytes,
+//	                         uint32 index offset, uint32 index count
+//	vertex buffer          VertexCount * VertexStride float32, interleaved as
+//	                         by ObjectPrimitive.Interleave
+//	index buffer           IndexCount uint32
+type meshCacheHeader struct {
+	Magic             [8]byte
+	Version           uint32
+	VertexStride      uint32
+	VertexCount       uint32
+	IndexCount        uint32
+	SubmeshCount      uint32
+	MaterialLibLength uint32
+	BoundsMin         [3]float32
+	BoundsMax         [3]float32
+	Checksum          uint32
+}
+
+var meshCacheTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SaveMeshCache writes obj to path in the binary mesh cache format, first
+// generating tangents for obj if it has none so they need not be computed at
+// load time. Materials embedded in the model are not stored; only the path
+// of its material library is.
+func SaveMeshCache(path string, obj *common.ObjectPrimitive) error {
+	if len(obj.Tangents) == 0 && obj.Interleaved == nil {
+		GenerateTangents(obj)
+	}
+
+	var payload bytes.Buffer
+
+	materialLib := obj.MaterialLib
+	if materialLib != "" {
+		if relative, err := filepath.Rel(filepath.Dir(path), materialLib); err == nil {
+			materialLib = filepath.ToSlash(relative)
+		}
+	}
+	payload.WriteString(materialLib)
+
+	writeString := func(s string) {
+		binary.Write(&payload, binary.LittleEndian, uint32(len(s)))
+		payload.WriteString(s)
+	}
+	for _, submesh := range obj.Submeshes {
+		writeString(submesh.Name)
+		writeString(submesh.Material)
+		binary.Write(&payload, binary.LittleEndian, [2]uint32{uint32(submesh.IndexOffset), uint32(submesh.IndexCount)})
+	}
+
+	vertices := obj.Interleave()
+	binary.Write(&payload, binary.LittleEndian, vertices)
+	binary.Write(&payload, binary.LittleEndian, obj.Indices)
+
+	header := meshCacheHeader{
+		Magic:             meshCacheMagic,
+		Version:           MeshCacheVersion,
+		VertexStride:      common.VertexStride,
+		VertexCount:       uint32(len(vertices) / common.VertexStride),
+		IndexCount:        uint32(len(obj.Indices)),
+		SubmeshCount:      uint32(len(obj.Submeshes)),
+		MaterialLibLength: uint32(len(materialLib)),
+		Checksum:          crc32.Checksum(payload.Bytes(), meshCacheTable),
+	}
+	bounds := common.ComputeAABB(obj.Vertices)
+	header.BoundsMin, header.BoundsMax = bounds.Min, bounds.Max
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(file, binary.LittleEndian, &header); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := payload.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// LoadMeshCache reads a mesh written by SaveMeshCache. The vertex buffer is
+// read in one piece into Interleaved, ready to be uploaded as it is, and only
+// the positions are copied out of it into Vertices; call SplitInterleaved for
+// the other attributes.
+func LoadMeshCache(path string) (*common.ObjectPrimitive, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bytes.NewReader(data)
+	var header meshCacheHeader
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, ErrInvalidMeshCache)
+	}
+	if header.Magic != meshCacheMagic {
+		return nil, fmt.Errorf("%s: bad magic: %w", path, ErrInvalidMeshCache)
+	}
+	if header.Version != MeshCacheVersion {
+		return nil, fmt.Errorf("%s: version %d, expected %d: %w", path, header.Version, MeshCacheVersion, ErrInvalidMeshCache)
+	}
+	if header.VertexStride != common.VertexStride {
+		return nil, fmt.Errorf("%s: vertex stride %d, expected %d: %w", path, header.VertexStride, common.VertexStride, ErrInvalidMeshCache)
+	}
+
+	payload := data[len(data)-reader.Len():]
+	if crc32.Checksum(payload, meshCacheTable) != header.Checksum {
+		return nil, fmt.Errorf("%s: checksum mismatch: %w", path, ErrInvalidMeshCache)
+	}
+
+	fail := func(err error) (*common.ObjectPrimitive, error) {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			err = ErrInvalidMeshCache
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	readString := func(length uint32) (string, error) {
+		if int64(length) > int64(reader.Len()) {
+			return "", ErrInvalidMeshCache
+		}
+		buffer := make([]byte, length)
+		_, err := io.ReadFull(reader, buffer)
+		return string(buffer), err
+	}
+
+	obj := &common.ObjectPrimitive{}
+
+	materialLib, err := readString(header.MaterialLibLength)
+	if err != nil {
+		return fail(err)
+	}
+	if materialLib != "" {
+		obj.MaterialLib = ResolvePath(path, materialLib, nil)
+	}
+
+	for i := uint32(0); i < header.SubmeshCount; i++ {
+		var submesh common.Submesh
+		var length uint32
+
+		if err := binary.Read(reader, binary.LittleEndian, &length); err != nil {
+			return fail(err)
+		}
+		if submesh.Name, err = readString(length); err != nil {
+			return fail(err)
+		}
+		if err := binary.Read(reader, binary.LittleEndian, &length); err != nil {
+			return fail(err)
+		}
+		if submesh.Material, err = readString(length); err != nil {
+			return fail(err)
+		}
+
+		var indexRange [2]uint32
+		if err := binary.Read(reader, binary.LittleEndian, &indexRange); err != nil {
+			return fail(err)
+		}
+		if uint64(indexRange[0])+uint64(indexRange[1]) > uint64(header.IndexCount) {
+			return fail(ErrIndexOutOfRange)
+		}
+		submesh.IndexOffset, submesh.IndexCount = int(indexRange[0]), int(indexRange[1])
+		obj.Submeshes = append(obj.Submeshes, submesh)
+	}
+
+	vertexBytes := uint64(header.VertexCount) * common.VertexStride * 4
+	if uint64(reader.Len()) != vertexBytes+uint64(header.IndexCount)*4 {
+		return fail(ErrInvalidMeshCache)
+	}
+	buffers := payload[len(payload)-reader.Len():]
+
+	vertexCount := int(header.VertexCount)
+	obj.Interleaved = make([]float32, vertexCount*common.VertexStride)
+	for i := range obj.Interleaved {
+		obj.Interleaved[i] = math.Float32frombits(binary.LittleEndian.Uint32(buffers[i*4:]))
+	}
+
+	// Bounds, culling and simplification need the positions on their own.
+	obj.Vertices = make([]float32, vertexCount*3)
+	for v := 0; v < vertexCount; v++ {
+		copy(obj.Vertices[v*3:v*3+3], obj.Interleaved[v*common.VertexStride:])
+	}
+
+	indices := buffers[vertexBytes:]
+	obj.Indices = make([]uint32, header.IndexCount)
+	for i := range obj.Indices {
+		obj.Indices[i] = binary.LittleEndian.Uint32(indices[i*4:])
+		if obj.Indices[i] >= header.VertexCount {
+			return fail(ErrIndexOutOfRange)
+		}
+	}
+
+	// The box is stored; only the sphere's radius needs the positions.
+	obj.Bounds = common.AABB{Min: header.BoundsMin, Max: header.BoundsMax}
+	obj.Sphere = common.ComputeBoundingSphere(obj.Vertices, obj.Bounds)
+
+	return obj, nil
+}
@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"errors"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testQuad returns a textured unit quad split into two submeshes.
+func testQuad() *common.ObjectPrimitive {
+	obj := &common.ObjectPrimitive{
+		Vertices: []float32{0, 0, 0, 1, 0, 0, 1, 1, 0, 0, 1, 0},
+		UVs:      []float32{0, 0, 1, 0, 1, 1, 0, 1},
+		Normals:  []float32{0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1},
+		Indices:  []uint32{0, 1, 2, 0, 2, 3},
+		Submeshes: []common.Submesh{
+			{Name: "lower", Material: "paper", IndexOffset: 0, IndexCount: 3},
+			{Name: "upper", Material: "ink", IndexOffset: 3, IndexCount: 3},
+		},
+	}
+	obj.UpdateBounds()
+	return obj
+}
+
+func TestMeshCacheRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "quad"+MeshCacheExt)
+
+	obj := testQuad()
+	obj.MaterialLib = filepath.Join(dir, "materials", "quad.mtl")
+	if err := SaveMeshCache(path, obj); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadMeshCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(loaded.Interleave(), obj.Interleave()) {
+		t.Errorf("vertex buffer: got %v, want %v", loaded.Interleave(), obj.Interleave())
+	}
+	if !reflect.DeepEqual(loaded.Vertices, obj.Vertices) {
+		t.Errorf("positions: got %v, want %v", loaded.Vertices, obj.Vertices)
+	}
+	if !reflect.DeepEqual(loaded.Indices, obj.Indices) {
+		t.Errorf("indices: got %v, want %v", loaded.Indices, obj.Indices)
+	}
+	if !reflect.DeepEqual(loaded.Submeshes, obj.Submeshes) {
+		t.Errorf("submeshes: got %v, want %v", loaded.Submeshes, obj.Submeshes)
+	}
+	if loaded.MaterialLib != obj.MaterialLib {
+		t.Errorf("material library: got %q, want %q", loaded.MaterialLib, obj.MaterialLib)
+	}
+	if loaded.Bounds != obj.Bounds || loaded.Sphere != obj.Sphere {
+		t.Errorf("bounds: got %v %v, want %v %v", loaded.Bounds, loaded.Sphere, obj.Bounds, obj.Sphere)
+	}
+
+	loaded.SplitInterleaved()
+	if loaded.Interleaved != nil {
+		t.Error("SplitInterleaved kept the interleaved buffer")
+	}
+	for _, attribute := range []struct {
+		name      string
+		got, want []float32
+	}{
+		{"uvs", loaded.UVs, obj.UVs},
+		{"normals", loaded.Normals, obj.Normals},
+		{"tangents", loaded.Tangents, obj.Tangents},
+	} {
+		if !reflect.DeepEqual(attribute.got, attribute.want) {
+			t.Errorf("%s after SplitInterleaved: got %v, want %v", attribute.name, attribute.got, attribute.want)
+		}
+	}
+}
+
+func TestMeshCacheRejectsDamage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quad"+MeshCacheExt)
+	if err := SaveMeshCache(path, testQuad()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		damage func([]byte) []byte
+	}{
+		{"flipped payload byte", func(b []byte) []byte { b[len(b)-5] ^= 0x40; return b }},
+		{"truncated payload", func(b []byte) []byte { return b[:len(b)-4] }},
+		{"truncated header", func(b []byte) []byte { return b[:10] }},
+		{"bad magic", func(b []byte) []byte { b[0] = 'X'; return b }},
+		{"other version", func(b []byte) []byte { b[8]++; return b }},
+	}
+	for _, test := range tests {
+		damaged := test.damage(append([]byte(nil), data...))
+		if err := os.WriteFile(path, damaged, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadMeshCache(path); !errors.Is(err, ErrInvalidMeshCache) {
+			t.Errorf("%s: got %v, want ErrInvalidMeshCache", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Command meshconv converts models into the binary mesh cache format read by
+// tools.LoadMeshCache, so large assets skip text parsing at startup.
+//
+// Usage:
+//
+//	meshconv [-normals file|smooth|flat] [-optimize] [-weld tolerance] [-o output.lbmesh] model.obj [more.obj ...]
+//
+// Without -o each model is written next to its source with the extension
+// replaced by .lbmesh. Any format tools.LoadModel understands is accepted.
+// -optimize reorders triangles and vertices for the GPU caches with
+// tools.OptimizeMesh and reports the cache miss ratio before and after;
+// -weld also merges vertices closer than the tolerance.
+//
+// The cache only refers to a material library by path. Materials embedded in
+// a model, as in glTF files, are not stored; meshconv warns when it drops
+// them.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/tools"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	output := flag.String("o", "", "output file (only valid with a single input)")
+	normals := flag.String("normals", "file", "OBJ normals: file, smooth or flat")
+	optimize := flag.Bool("optimize", false, "reorder triangles and vertices for the vertex caches")
+	weld := flag.Float64("weld", 0, "with -optimize, merge vertices whose attributes differ by at most this much")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: meshconv [-normals file|smooth|flat] [-optimize] [-weld tolerance] [-o output.lbmesh] model [model ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || (*output != "" && flag.NArg() > 1) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	options := tools.OBJOptions{}
+	switch *normals {
+	case "file":
+		options.Normals = tools.NormalsFromFile
+	case "smooth":
+		options.Normals = tools.NormalsSmooth
+	case "flat":
+		options.Normals = tools.NormalsFlat
+	default:
+		fmt.Fprintln(os.Stderr, "unknown -normals mode:", *normals)
+		os.Exit(2)
+	}
+
+	var optimizeOptions *tools.OptimizeOptions
+	if *optimize || *weld > 0 {
+		optimizeOptions = &tools.OptimizeOptions{Weld: *weld > 0, WeldTolerance: float32(*weld)}
+	}
+
+	failed := false
+	for _, input := range flag.Args() {
+		target := *output
+		if target == "" {
+			target = strings.TrimSuffix(input, filepath.Ext(input)) + tools.MeshCacheExt
+		}
+
+		if err := convert(input, target, options, optimizeOptions); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+		fmt.Println(input, "->", target)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func convert(input, output string, options tools.OBJOptions, optimize *tools.OptimizeOptions) error {
+	var model *common.ObjectPrimitive
+	var err error
+
+	if strings.EqualFold(filepath.Ext(input), ".obj") {
+		model, err = tools.CreateNewOBJWithOptions(input, options)
+	} else {
+		model, err = tools.LoadModel(input, "")
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(model.Materials) > 0 && model.MaterialLib == "" {
+		fmt.Fprintf(os.Stderr, "%s: warning: %d embedded materials are not stored in the cache\n", input, len(model.Materials))
+	}
+
+	if optimize != nil {
+		stats := tools.OptimizeMesh(model, *optimize)
+		fmt.Printf("%s: ACMR %.3f -> %.3f, %d -> %d vertices\n", input, stats.ACMRBefore, stats.ACMRAfter, stats.VerticesBefore, stats.VerticesAfter)
+	}
+
+	return tools.SaveMeshCache(output, model)
+}
@@ -0,0 +1,25 @@
+package tools
+
+import (
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"path/filepath"
+	"strings"
+)
+
+// LoadModel loads a model with the loader matching its file extension,
+// treating anything unrecognised as OBJ. A non-empty mtlFPath replaces the
+// material library of an OBJ file and is ignored for other formats.
+func LoadModel(modelFPath, mtlFPath string) (*common.ObjectPrimitive, error) {
+	switch strings.ToLower(filepath.Ext(modelFPath)) {
+	case ".gltf", ".glb":
+		return CreateNewGLTF(modelFPath)
+	case ".stl":
+		return CreateNewSTL(modelFPath)
+	case ".ply":
+		return CreateNewPLY(modelFPath)
+	case MeshCacheExt:
+		return LoadMeshCache(modelFPath)
+	default:
+		return CreateNewOBJ(modelFPath, mtlFPath)
+	}
+}
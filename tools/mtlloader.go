@@ -3,11 +3,16 @@ package tools
 import (
 	"bufio"
 	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"github.com/go-gl/mathgl/mgl32"
 	"os"
+	"strconv"
 	"strings"
 )
 
-func ParseMTL(mtlFPath string) (map[string]*common.Material, error) {
+// ParseMTL reads the materials of an MTL library, by name. Texture paths are
+// resolved with ResolvePath, trying searchRoots when a texture is not next
+// to the library.
+func ParseMTL(mtlFPath string, searchRoots ...string) (map[string]*common.Material, error) {
 	materials := make(map[string]*common.Material)
 
 	file, err := os.Open(mtlFPath)
@@ -19,27 +24,213 @@ func ParseMTL(mtlFPath string) (map[string]*common.Material, error) {
 	var currentMaterial *common.Material
 
 	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+
+	fail := func(token string, err error) error {
+		return &OBJParseError{File: mtlFPath, Line: lineNumber, Token: token, Err: err}
+	}
+
 	for scanner.Scan() {
+		lineNumber++
 		line := scanner.Text()
 		line = strings.TrimSpace(line)
 
-		if len(line) == 0 {
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		keyword := strings.Fields(line)[0]
+		args := strings.TrimSpace(line[len(keyword):])
+
+		if keyword == "newmtl" {
+			currentMaterial = common.NewMaterial(args)
+			materials[args] = currentMaterial
+			continue
+		}
+		if currentMaterial == nil {
 			continue
 		}
 
+		var token string
+		switch strings.ToLower(keyword) {
+		case "ka":
+			currentMaterial.Ambient, token, err = parseColor(args)
+		case "kd":
+			currentMaterial.Diffuse, token, err = parseColor(args)
+		case "ks":
+			currentMaterial.Specular, token, err = parseColor(args)
+		case "ke":
+			currentMaterial.Emissive, token, err = parseColor(args)
+		case "ns":
+			currentMaterial.Shininess, token, err = parseScalar(args)
+		case "d":
+			// "d -halo factor" is treated as a plain dissolve.
+			currentMaterial.Dissolve, token, err = parseScalar(strings.TrimPrefix(args, "-halo "))
+		case "tr":
+			var transparency float32
+			transparency, token, err = parseScalar(args)
+			currentMaterial.Dissolve = 1 - transparency
+		case "pr":
+			currentMaterial.Roughness, token, err = parseScalar(args)
+			currentMaterial.PBR = true
+		case "pm":
+			currentMaterial.Metallic, token, err = parseScalar(args)
+			currentMaterial.PBR = true
+		case "illum":
+			currentMaterial.Illum, err = strconv.Atoi(args)
+			token = args
+		case "map_kd":
+			currentMaterial.DiffuseMap, token, err = parseTextureMap(args)
+		case "map_ks":
+			currentMaterial.SpecularMap, token, err = parseTextureMap(args)
+		case "map_ka":
+			currentMaterial.AmbientMap, token, err = parseTextureMap(args)
+		case "map_ke":
+			currentMaterial.EmissiveMap, token, err = parseTextureMap(args)
+		case "map_bump", "bump", "norm":
+			currentMaterial.NormalMap, token, err = parseTextureMap(args)
+		case "map_d":
+			currentMaterial.AlphaMap, token, err = parseTextureMap(args)
+		case "map_pr":
+			currentMaterial.RoughnessMap, token, err = parseTextureMap(args)
+			currentMaterial.PBR = true
+		case "map_pm":
+			currentMaterial.MetallicMap, token, err = parseTextureMap(args)
+			currentMaterial.PBR = true
+		}
+
+		if err != nil {
+			return nil, fail(token, err)
+		}
+	}
+
+	for _, material := range materials {
+		// MTL has no blend mode. A partial dissolve is taken to mean glass
+		// and the like, and an alpha map with full dissolve to mean cut
+		// out shapes such as leaves and cobwebs.
 		switch {
-		case strings.HasPrefix(line, "newmtl "):
-			materialName := line[7:]
-			currentMaterial = &common.Material{
-				Name: materialName,
+		case material.Dissolve < 1:
+			material.BlendMode = common.BlendBlended
+		case material.AlphaMap.Path != "":
+			material.BlendMode = common.BlendCutout
+		}
+
+		for _, textureMap := range []*common.TextureMap{
+			&material.DiffuseMap, &material.NormalMap, &material.SpecularMap, &material.RoughnessMap,
+			&material.MetallicMap, &material.AlphaMap, &material.AmbientMap, &material.EmissiveMap,
+			&material.OcclusionMap,
+		} {
+			textureMap.Path = ResolvePath(mtlFPath, textureMap.Path, searchRoots)
+		}
+	}
+
+	return materials, scanner.Err()
+}
+
+// parseColor reads an "r g b" colour. A single value is used for all three
+// channels, as allowed by the format. Spectral curves are not supported and
+// leave the colour black.
+func parseColor(args string) (mgl32.Vec3, string, error) {
+	if strings.HasPrefix(args, "spectral") {
+		return mgl32.Vec3{}, "", nil
+	}
+	args = strings.TrimPrefix(args, "xyz")
+
+	values, token, err := parseFloatRange(args, 1, 3)
+	if err != nil {
+		return mgl32.Vec3{}, token, err
+	}
+	if len(values) < 3 {
+		return mgl32.Vec3{values[0], values[0], values[0]}, "", nil
+	}
+	return mgl32.Vec3{values[0], values[1], values[2]}, "", nil
+}
+
+func parseScalar(args string) (float32, string, error) {
+	values, token, err := parseFloats(args, 1)
+	if err != nil {
+		return 0, token, err
+	}
+	return values[0], "", nil
+}
+
+// textureOptionArgs lists how many arguments each texture option takes. -o,
+// -s and -t accept between one and three numbers.
+var textureOptionArgs = map[string]int{
+	"-blendu":  1,
+	"-blendv":  1,
+	"-boost":   1,
+	"-cc":      1,
+	"-clamp":   1,
+	"-bm":      1,
+	"-imfchan": 1,
+	"-texres":  1,
+	"-type":    1,
+	"-mm":      2,
+	"-o":       3,
+	"-s":       3,
+	"-t":       3,
+}
+
+// parseTextureMap reads a texture statement such as
+// "map_Kd -s 2 2 1 -clamp on wood.png". Everything after the options is the
+// file name, which may contain spaces.
+func parseTextureMap(args string) (common.TextureMap, string, error) {
+	textureMap := common.NewTextureMap("")
+	fields := strings.Fields(args)
+
+	i := 0
+	for i < len(fields) {
+		option := fields[i]
+		argCount, ok := textureOptionArgs[option]
+		if !ok {
+			break
+		}
+		i++
+
+		// Vector options take as many numbers as follow, up to three.
+		var values []string
+		for len(values) < argCount && i < len(fields) {
+			if option == "-o" || option == "-s" || option == "-t" {
+				if _, err := strconv.ParseFloat(fields[i], 32); err != nil {
+					break
+				}
+			}
+			values = append(values, fields[i])
+			i++
+		}
+		if len(values) == 0 {
+			return textureMap, option, ErrMissingComponent
+		}
+
+		switch option {
+		case "-s", "-o":
+			vector, token, err := parseFloats(strings.Join(values, " "), len(values))
+			if err != nil {
+				return textureMap, token, err
 			}
-			materials[materialName] = currentMaterial
-		case strings.HasPrefix(line, "map_Kd "):
-			if currentMaterial != nil {
-				currentMaterial.DiffuseMap = line[7:]
+			target := &textureMap.Scale
+			if option == "-o" {
+				target = &textureMap.Offset
 			}
+			for k, value := range vector {
+				target[k] = value
+			}
+		case "-clamp":
+			textureMap.Clamp = values[0] == "on"
+		case "-bm":
+			multiplier, err := strconv.ParseFloat(values[0], 32)
+			if err != nil {
+				return textureMap, values[0], err
+			}
+			textureMap.BumpMultiplier = float32(multiplier)
 		}
 	}
 
-	return materials, scanner.Err()
+	if i >= len(fields) {
+		return textureMap, args, ErrMissingComponent
+	}
+	textureMap.Path = strings.Join(fields[i:], " ")
+
+	return textureMap, "", nil
 }
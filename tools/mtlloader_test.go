@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"errors"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"github.com/go-gl/mathgl/mgl32"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testMTL = `# textured, glass, cut out and default materials
+newmtl brick
+Ka 0.1 0.2 0.3
+Kd 0.5
+Ks 0.4 0.5 0.6
+Ke 1 0 0
+Ns 32
+illum 2
+map_Kd -s 2 3 -o 0.5 -clamp on brick wall.png
+bump -bm 0.5 brick_n.png
+map_Ks -clamp off spec.png
+
+newmtl glass
+Tr 0.75
+Pr 0.3
+Pm 0.8
+norm glass_n.png
+
+newmtl leaf
+d 1
+map_Bump leaf_n.png
+map_d leaf alpha.png
+
+newmtl plain
+`
+
+func TestParseMTL(t *testing.T) {
+	path := writeTestFile(t, "test.mtl", testMTL)
+	dir := filepath.Dir(path)
+
+	materials, err := ParseMTL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(materials) != 4 {
+		t.Fatalf("got %d materials, want 4", len(materials))
+	}
+
+	brick := materials["brick"]
+	if brick.Name != "brick" {
+		t.Errorf("brick: got name %q", brick.Name)
+	}
+	colors := []struct {
+		name      string
+		got, want mgl32.Vec3
+	}{
+		{"Ka", brick.Ambient, mgl32.Vec3{0.1, 0.2, 0.3}},
+		{"Kd", brick.Diffuse, mgl32.Vec3{0.5, 0.5, 0.5}},
+		{"Ks", brick.Specular, mgl32.Vec3{0.4, 0.5, 0.6}},
+		{"Ke", brick.Emissive, mgl32.Vec3{1, 0, 0}},
+	}
+	for _, color := range colors {
+		if color.got != color.want {
+			t.Errorf("brick %s: got %v, want %v", color.name, color.got, color.want)
+		}
+	}
+	if brick.Shininess != 32 || brick.Illum != 2 || brick.Dissolve != 1 {
+		t.Errorf("brick: got Ns %v, illum %d, d %v, want 32, 2, 1", brick.Shininess, brick.Illum, brick.Dissolve)
+	}
+	if brick.PBR || brick.BlendMode != common.BlendOpaque {
+		t.Errorf("brick: got PBR %v, blend mode %v, want false, opaque", brick.PBR, brick.BlendMode)
+	}
+
+	// -s and -o with fewer than three numbers leave the rest at their
+	// defaults, and the path keeps its space.
+	diffuse := common.NewTextureMap(filepath.Join(dir, "brick wall.png"))
+	diffuse.Scale = mgl32.Vec3{2, 3, 1}
+	diffuse.Offset = mgl32.Vec3{0.5, 0, 0}
+	diffuse.Clamp = true
+	normal := common.NewTextureMap(filepath.Join(dir, "brick_n.png"))
+	normal.BumpMultiplier = 0.5
+	maps := []struct {
+		name      string
+		got, want common.TextureMap
+	}{
+		{"map_Kd", brick.DiffuseMap, diffuse},
+		{"bump", brick.NormalMap, normal},
+		{"map_Ks", brick.SpecularMap, common.NewTextureMap(filepath.Join(dir, "spec.png"))},
+		// Maps the file leaves out keep the zero value.
+		{"map_Ka", brick.AmbientMap, common.TextureMap{}},
+	}
+	for _, m := range maps {
+		if !reflect.DeepEqual(m.got, m.want) {
+			t.Errorf("brick %s: got %+v, want %+v", m.name, m.got, m.want)
+		}
+	}
+
+	glass := materials["glass"]
+	if glass.Dissolve != 0.25 || glass.BlendMode != common.BlendBlended {
+		t.Errorf("glass: got d %v, blend mode %v, want 0.25, blended", glass.Dissolve, glass.BlendMode)
+	}
+	if glass.Roughness != 0.3 || glass.Metallic != 0.8 || !glass.PBR {
+		t.Errorf("glass: got Pr %v, Pm %v, PBR %v, want 0.3, 0.8, true", glass.Roughness, glass.Metallic, glass.PBR)
+	}
+	if want := filepath.Join(dir, "glass_n.png"); glass.NormalMap.Path != want {
+		t.Errorf("glass norm: got %q, want %q", glass.NormalMap.Path, want)
+	}
+
+	leaf := materials["leaf"]
+	if want := filepath.Join(dir, "leaf_n.png"); leaf.NormalMap.Path != want {
+		t.Errorf("leaf map_Bump: got %q, want %q", leaf.NormalMap.Path, want)
+	}
+	if want := filepath.Join(dir, "leaf alpha.png"); leaf.AlphaMap.Path != want {
+		t.Errorf("leaf map_d: got %q, want %q", leaf.AlphaMap.Path, want)
+	}
+	if leaf.BlendMode != common.BlendCutout {
+		t.Errorf("leaf: got blend mode %v, want cutout", leaf.BlendMode)
+	}
+
+	if plain, want := materials["plain"], common.NewMaterial("plain"); !reflect.DeepEqual(plain, want) {
+		t.Errorf("plain: got %+v, want the defaults %+v", plain, want)
+	}
+}
+
+func TestParseMTLErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		line  int
+		token string
+		err   error
+	}{
+		{"bad colour", []string{"newmtl a", "Kd 1 x 1"}, 2, "x", nil},
+		{"bad scalar", []string{"newmtl a", "Kd 1 1 1", "Ns shiny"}, 3, "shiny", nil},
+		{"bad illum", []string{"newmtl a", "illum two"}, 2, "two", nil},
+		{"bad bump multiplier", []string{"newmtl a", "bump -bm q a.png"}, 2, "q", nil},
+		{"scale without numbers", []string{"newmtl a", "map_Kd -s a.png"}, 2, "-s", ErrMissingComponent},
+		{"missing texture path", []string{"newmtl a", "map_Kd -clamp on"}, 2, "-clamp on", ErrMissingComponent},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, "bad.mtl", strings.Join(test.lines, "\n")+"\n")
+		_, err := ParseMTL(path)
+
+		var parseErr *OBJParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%s: got %v, want an *OBJParseError", test.name, err)
+			continue
+		}
+		if parseErr.File != path || parseErr.Line != test.line || parseErr.Token != test.token {
+			t.Errorf("%s: got %s:%d %q, want line %d %q", test.name, parseErr.File, parseErr.Line, parseErr.Token, test.line, test.token)
+		}
+		if test.err != nil && !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package tools
+
+import "math"
+
+// NormalMode selects how vertex normals are filled when a model is loaded.
+type NormalMode int
+
+const (
+	// NormalsFromFile keeps the normals stored in the file and generates
+	// smooth normals only for corners that have none.
+	NormalsFromFile NormalMode = iota
+	// NormalsSmooth ignores stored normals and generates smooth ones,
+	// honouring smoothing groups where the format has them.
+	NormalsSmooth
+	// NormalsFlat ignores stored normals and uses the face normal for every
+	// corner.
+	NormalsFlat
+)
+
+// generateNormals computes one normal per triangle corner. corners holds the
+// position index of every corner, three per triangle, and groups holds the
+// smoothing group of every triangle. Corners that share a position and a
+// non-zero smoothing group receive the same normal, weighted by the area of
+// each adjacent triangle and its angle at that corner. Triangles in group
+// zero are shaded flat.
+func generateNormals(positions [][3]float32, corners []int, groups []uint32, flat bool) [][3]float32 {
+	type smoothKey struct {
+		position int
+		group    uint32
+	}
+
+	triangleCount := len(corners) / 3
+	faceNormals := make([][3]float64, triangleCount)
+	sums := make(map[smoothKey][3]float64)
+
+	for t := 0; t < triangleCount; t++ {
+		a := positions[corners[t*3]]
+		b := positions[corners[t*3+1]]
+		c := positions[corners[t*3+2]]
+
+		// The cross product's length is twice the triangle's area, which
+		// gives the area weighting for free.
+		normal := cross64(sub64(b, a), sub64(c, a))
+		faceNormals[t] = normal
+
+		if flat || groups[t] == 0 {
+			continue
+		}
+
+		triangle := [3][3]float32{a, b, c}
+		for k := 0; k < 3; k++ {
+			angle := cornerAngle(triangle[k], triangle[(k+1)%3], triangle[(k+2)%3])
+			key := smoothKey{corners[t*3+k], groups[t]}
+
+			sum := sums[key]
+			for i := range sum {
+				sum[i] += normal[i] * angle
+			}
+			sums[key] = sum
+		}
+	}
+
+	normals := make([][3]float32, len(corners))
+	for i, position := range corners {
+		t := i / 3
+		normal := faceNormals[t]
+		if !flat && groups[t] != 0 {
+			normal = sums[smoothKey{position, groups[t]}]
+		}
+		normals[i] = normalize64(normal)
+	}
+	return normals
+}
+
+// cornerAngle returns the angle at corner p of the triangle p, q, r.
+func cornerAngle(p, q, r [3]float32) float64 {
+	u := normalize64(sub64(q, p))
+	v := normalize64(sub64(r, p))
+
+	dot := float64(u[0])*float64(v[0]) + float64(u[1])*float64(v[1]) + float64(u[2])*float64(v[2])
+	return math.Acos(math.Max(-1, math.Min(1, dot)))
+}
+
+func sub64(a, b [3]float32) [3]float64 {
+	return [3]float64{float64(a[0] - b[0]), float64(a[1] - b[1]), float64(a[2] - b[2])}
+}
+
+func cross64(a, b [3]float64) [3]float64 {
+	return [3]float64{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
+
+// normalize64 returns v scaled to unit length, or +Y for a zero vector so that
+// degenerate geometry still gets a usable normal.
+func normalize64(v [3]float64) [3]float32 {
+	length := math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+	if length == 0 || math.IsNaN(length) {
+		return [3]float32{0, 1, 0}
+	}
+	return [3]float32{float32(v[0] / length), float32(v[1] / length), float32(v[2] / length)}
+}
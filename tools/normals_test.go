@@ -0,0 +1,40 @@
+package tools
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGenerateNormals(t *testing.T) {
+	// Two triangles folded at a right angle along the edge from 0 to 1: the
+	// first faces +z, the second -y.
+	positions := [][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0, -1}}
+	corners := []int{0, 1, 2, 1, 0, 3}
+	up, down := [3]float32{0, 0, 1}, [3]float32{0, -1, 0}
+	s := float32(math.Sqrt(0.5))
+	shared := [3]float32{0, -s, s}
+
+	tests := []struct {
+		name   string
+		groups []uint32
+		flat   bool
+		want   [][3]float32
+	}{
+		{"one smoothing group", []uint32{1, 1}, false, [][3]float32{shared, shared, up, shared, shared, down}},
+		{"two smoothing groups", []uint32{1, 2}, false, [][3]float32{up, up, up, down, down, down}},
+		{"smoothing off", []uint32{0, 0}, false, [][3]float32{up, up, up, down, down, down}},
+		{"flat", []uint32{1, 1}, true, [][3]float32{up, up, up, down, down, down}},
+	}
+
+	for _, test := range tests {
+		normals := generateNormals(positions, corners, test.groups, test.flat)
+		for i, normal := range normals {
+			for k := range normal {
+				if math.Abs(float64(normal[k]-test.want[i][k])) > 1e-5 {
+					t.Errorf("%s: corner %d has normal %v, want %v", test.name, i, normal, test.want[i])
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Command objbench measures how long OBJ files take to load and how much
+// memory loading them costs, for the streaming parser and for the parallel
+// chunked mode at different worker counts.
+//
+// Usage:
+//
+//	objbench [-workers 1,4,8] [-runs 3] [-generate n] [model.obj ...]
+//
+// With -generate, an n by n grid of quads with texture coordinates and
+// normals is written to a temporary file and measured before the named
+// files, then removed; n = 1500 gives roughly 400 MB. Named files are only
+// read. The loader's benchmarks, go test -bench OBJLoad ./tools, measure the
+// same grid at a smaller size.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/tools"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func main() {
+	defaultWorkers := "1"
+	if runtime.NumCPU() > 1 {
+		defaultWorkers += "," + strconv.Itoa(runtime.NumCPU())
+	}
+	workerList := flag.String("workers", defaultWorkers, "comma separated worker counts to measure")
+	runs := flag.Int("runs", 3, "loads per measurement; the fastest is reported")
+	generate := flag.Int("generate", 0, "also measure a temporary n by n quad grid")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: objbench [-workers 1,4,8] [-runs 3] [-generate n] [model.obj ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if (flag.NArg() == 0 && *generate <= 0) || *runs < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var workers []int
+	for _, field := range strings.Split(*workerList, ",") {
+		count, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || count < 1 {
+			fmt.Fprintln(os.Stderr, "bad worker count:", field)
+			os.Exit(2)
+		}
+		workers = append(workers, count)
+	}
+
+	paths := flag.Args()
+	grid := ""
+	if *generate > 0 {
+		var err error
+		if grid, err = writeGrid(*generate); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		paths = append([]string{grid}, paths...)
+	}
+
+	err := measureAll(paths, workers, *runs)
+	if grid != "" {
+		os.Remove(grid)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func measureAll(paths []string, workers []int, runs int) error {
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		size := float64(info.Size()) / (1 << 20)
+		fmt.Printf("%s: %.1f MB\n", path, size)
+
+		for _, count := range workers {
+			if err := measure(path, size, count, runs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// measure loads path runs times with the given worker count and prints the
+// fastest time along with the memory used by a single load.
+func measure(path string, size float64, workers, runs int) error {
+	best := time.Duration(0)
+	var allocated, retained uint64
+	var vertices, triangles int
+
+	for run := 0; run < runs; run++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		start := time.Now()
+		obj, err := tools.CreateNewOBJWithOptions(path, tools.OBJOptions{Workers: workers})
+		elapsed := time.Since(start)
+		if err != nil {
+			return err
+		}
+
+		runtime.ReadMemStats(&after)
+		allocated = after.TotalAlloc - before.TotalAlloc
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		retained = after.HeapAlloc - before.HeapAlloc
+
+		vertices, triangles = len(obj.Vertices)/3, len(obj.Indices)/3
+		if best == 0 || elapsed < best {
+			best = elapsed
+		}
+		runtime.KeepAlive(obj)
+	}
+
+	fmt.Printf("  workers %-3d %8.3fs %8.1f MB/s  allocated %7.1f MB  retained %7.1f MB  %d vertices, %d triangles\n",
+		workers, best.Seconds(), size/best.Seconds(), float64(allocated)/(1<<20), float64(retained)/(1<<20), vertices, triangles)
+	return nil
+}
+
+// writeGrid writes an n by n grid of quads, with a texture coordinate and
+// normal for every vertex, to a new temporary file as a stand-in for a large
+// scanned or generated model, and returns its path.
+func writeGrid(n int) (string, error) {
+	file, err := os.CreateTemp("", "objbench-*.obj")
+	if err != nil {
+		return "", err
+	}
+	out := bufio.NewWriter(file)
+
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			fmt.Fprintf(out, "v %f %f %f\n", float64(x)*0.01, float64(y)*0.01, float64((x*y)%7)*0.1)
+		}
+	}
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			fmt.Fprintf(out, "vt %f %f\n", float64(x)/float64(n), float64(y)/float64(n))
+		}
+	}
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			fmt.Fprintf(out, "vn %f %f %f\n", 0.0, 0.0, 1.0)
+		}
+	}
+
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			a := y*(n+1) + x + 1
+			b, c, d := a+1, a+n+2, a+n+1
+			fmt.Fprintf(out, "f %d/%d/%d %d/%d/%d %d/%d/%d %d/%d/%d\n", a, a, a, b, b, b, c, c, c, d, d, d)
+		}
+	}
+
+	if err := out.Flush(); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
@@ -2,133 +2,548 @@ package tools
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"io"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 )
 
+var (
+	ErrMissingComponent = errors.New("missing component")
+	ErrIndexOutOfRange  = errors.New("index out of range")
+)
+
+// OBJParseError reports a malformed statement in an OBJ or MTL file, pointing
+// at the line and the token that could not be understood.
+type OBJParseError struct {
+	File  string
+	Line  int
+	Token string
+	Err   error
+}
+
+func (e *OBJParseError) Error() string {
+	return fmt.Sprintf("%s:%d: bad token %q: %v", e.File, e.Line, e.Token, e.Err)
+}
+
+func (e *OBJParseError) Unwrap() error {
+	return e.Err
+}
+
 type Vertex struct {
 	Position [3]float32
 	UV       [2]float32
 	Normal   [3]float32
 }
 
-func CreateNewOBJ(modelFPath, mtlFPath string) *common.ObjectPrimitive {
-	objPrimitive := &common.ObjectPrimitive{}
-	objPrimitive.Vertices, objPrimitive.Normals, objPrimitive.UVs, objPrimitive.Indices = loadOBJFromFile(modelFPath)
+// OBJOptions controls how CreateNewOBJWithOptions builds a mesh.
+type OBJOptions struct {
+	Normals NormalMode
+	// Workers above one reads the whole file into memory and parses that
+	// many chunks of it concurrently, which is much faster for large files.
+	// Otherwise the file is streamed a line at a time.
+	Workers int
+	// SearchRoots lists extra directories that are searched, in order, for
+	// the material library when it is not next to the OBJ file. See
+	// ResolvePath.
+	SearchRoots []string
+}
+
+// CreateNewOBJ loads an OBJ file with the default options. A non-empty
+// mtlFPath replaces the material library the file names.
+func CreateNewOBJ(modelFPath, mtlFPath string) (*common.ObjectPrimitive, error) {
+	obj, err := CreateNewOBJWithOptions(modelFPath, OBJOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if mtlFPath != "" {
+		obj.MaterialLib = mtlFPath
+	}
+	return obj, nil
+}
+
+func CreateNewOBJWithOptions(modelFPath string, options OBJOptions) (*common.ObjectPrimitive, error) {
+	return loadOBJFromFile(modelFPath, options)
+}
+
+// objRange is a run of triangles sharing a smoothing group.
+type objRange struct {
+	corners   []objCorner
+	smoothing uint32
+}
+
+// objGroup collects the triangles of one object/group and material pair until
+// they are laid out as a submesh.
+type objGroup struct {
+	name        string
+	material    string
+	ranges      []objRange
+	cornerCount int
+}
+
+func loadOBJFromFile(filePath string, options OBJOptions) (*common.ObjectPrimitive, error) {
+	var chunks []*objChunk
+	var err error
+	if options.Workers > 1 {
+		chunks, err = parseOBJChunks(filePath, options.Workers)
+	} else {
+		var chunk *objChunk
+		chunk, err = streamOBJ(filePath)
+		chunks = []*objChunk{chunk}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	positions, uvs, normals, err := resolveOBJChunks(chunks)
+	if err != nil {
+		return nil, err
+	}
+
+	var materialLib string
+	for _, chunk := range chunks {
+		if chunk.materialLib != "" {
+			materialLib = ResolvePath(filePath, chunk.materialLib, options.SearchRoots)
+			break
+		}
+	}
+
+	groups, hasSmoothingGroups := groupOBJChunks(chunks)
+
+	// Lay the corners out in submesh order so generated normals and indices
+	// can be matched up by position.
+	var corners []objCorner
+	if len(groups) == 1 && len(groups[0].ranges) == 1 {
+		corners = groups[0].ranges[0].corners
+	} else {
+		corners = make([]objCorner, 0, countCorners(groups))
+		for _, group := range groups {
+			for _, run := range group.ranges {
+				corners = append(corners, run.corners...)
+			}
+		}
+	}
+
+	var objPrimitive *common.ObjectPrimitive
+	if needsGeneratedNormals(corners, options.Normals) {
+		var smoothing []uint32
+		for _, group := range groups {
+			for _, run := range group.ranges {
+				value := run.smoothing
+				if !hasSmoothingGroups && options.Normals != NormalsFlat {
+					// Files that never mention smoothing groups are smoothed
+					// as a whole rather than being shaded flat.
+					value = 1
+				}
+				for t := 0; t < len(run.corners)/3; t++ {
+					smoothing = append(smoothing, value)
+				}
+			}
+		}
+		objPrimitive = buildOBJWithGeneratedNormals(corners, smoothing, positions, uvs, normals, options.Normals)
+	} else {
+		objPrimitive = buildOBJ(corners, positions, uvs, normals)
+	}
+	objPrimitive.MaterialLib = materialLib
+
+	// Faces sharing a group and material are drawn together, even when the
+	// file switches back and forth between them.
+	offset := 0
+	for _, group := range groups {
+		objPrimitive.Submeshes = append(objPrimitive.Submeshes, common.Submesh{
+			Name:        group.name,
+			Material:    group.material,
+			IndexOffset: offset,
+			IndexCount:  group.cornerCount,
+		})
+		offset += group.cornerCount
+	}
+	objPrimitive.UpdateBounds()
 
-	return objPrimitive
+	return objPrimitive, nil
 }
 
-func loadOBJFromFile(filePath string) (vertices, normals, textureCoords []float32, indices []uint32) {
+// streamOBJ parses a file a line at a time into a single chunk.
+func streamOBJ(filePath string) (*objChunk, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer file.Close()
 
-	var positions [][]float32
-	var uvs [][]float32
-	var normalsList [][]float32
-	var vertexMap = make(map[Vertex]uint32)
-	var uniqueVertices []float32
-	var uniqueNormals []float32
-	var uniqueUVs []float32
-	var newIndices []uint32
-	var nextIndex uint32 = 0
-
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.TrimSpace(line)
-		if len(line) == 0 {
+	chunk := &objChunk{file: filePath, strict: true}
+	reader := bufio.NewReaderSize(file, 64*1024)
+
+	var long []byte // a line that did not fit in the reader's buffer
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			long = append(long, line...)
 			continue
 		}
+		if len(long) > 0 {
+			line = append(long, line...)
+			long = long[:0]
+		}
 
-		switch {
-		case strings.HasPrefix(line, "v "):
-			positions = append(positions, parseVec3(line))
-		case strings.HasPrefix(line, "vn "):
-			normalsList = append(normalsList, parseVec3(line))
-		case strings.HasPrefix(line, "vt "):
-			uvs = append(uvs, parseVec2(line))
-		case strings.HasPrefix(line, "f "):
-			faceVertices := parseFace(line)
-
-			for _, fv := range faceVertices {
-				vertex := Vertex{
-					Position: [3]float32{
-						positions[fv.Position-1][0],
-						positions[fv.Position-1][1],
-						positions[fv.Position-1][2],
-					},
-					UV: [2]float32{
-						uvs[fv.UV-1][0],
-						uvs[fv.UV-1][1],
-					},
-					Normal: [3]float32{
-						normalsList[fv.Normal-1][0],
-						normalsList[fv.Normal-1][1],
-						normalsList[fv.Normal-1][2],
-					},
-				}
+		if len(line) > 0 {
+			if err := chunk.parseLine(line); err != nil {
+				return nil, err
+			}
+		}
+		if err == io.EOF {
+			return chunk, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
 
-				if index, found := vertexMap[vertex]; found {
-					newIndices = append(newIndices, index)
-				} else {
-					uniqueVertices = append(uniqueVertices, vertex.Position[:]...)
-					uniqueUVs = append(uniqueUVs, vertex.UV[:]...)
-					uniqueNormals = append(uniqueNormals, vertex.Normal[:]...)
-					vertexMap[vertex] = nextIndex
-					newIndices = append(newIndices, nextIndex)
-					nextIndex++
-				}
+// parseOBJChunks reads a whole file and parses it as the given number of
+// chunks concurrently.
+func parseOBJChunks(filePath string, workers int) ([]*objChunk, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var pieces [][]byte
+	chunkSize := len(data)/workers + 1
+	for len(data) > 0 {
+		end := len(data)
+		if chunkSize < end {
+			if i := bytes.IndexByte(data[chunkSize:], '\n'); i >= 0 {
+				end = chunkSize + i + 1
 			}
 		}
+		pieces = append(pieces, data[:end])
+		data = data[end:]
 	}
 
-	return uniqueVertices, uniqueNormals, uniqueUVs, newIndices
+	chunks := make([]*objChunk, len(pieces))
+	errs := make([]error, len(pieces))
+	var wg sync.WaitGroup
+	for i := range pieces {
+		chunks[i] = &objChunk{file: filePath, strict: i == 0}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = chunks[i].parseLines(pieces[i])
+		}(i)
+	}
+	wg.Wait()
+
+	// Chunks count lines from their own start; report the first error
+	// against the whole file.
+	lines := 0
+	for i, err := range errs {
+		chunks[i].firstLine = lines
+		if err != nil {
+			var parseErr *OBJParseError
+			if errors.As(err, &parseErr) {
+				parseErr.Line += lines
+			}
+			return nil, err
+		}
+		lines += chunks[i].lines
+	}
+	return chunks, nil
 }
 
-func parseVec3(line string) []float32 {
-	parts := strings.Fields(line[2:])
-	x, _ := strconv.ParseFloat(parts[0], 32)
-	y, _ := strconv.ParseFloat(parts[1], 32)
-	z, _ := strconv.ParseFloat(parts[2], 32)
-	return []float32{float32(x), float32(y), float32(z)}
+// resolveOBJChunks joins the attributes of all chunks, then makes every face
+// index 0-based and triangulates every face, concurrently for each chunk.
+func resolveOBJChunks(chunks []*objChunk) (positions, uvs, normals []float32, err error) {
+	bases := make([][3]int, len(chunks))
+	var total [3]int
+	for i, chunk := range chunks {
+		bases[i] = total
+		total[0] += len(chunk.positions) / 3
+		total[1] += len(chunk.uvs) / 2
+		total[2] += len(chunk.normals) / 3
+	}
+
+	if len(chunks) == 1 {
+		positions, uvs, normals = chunks[0].positions, chunks[0].uvs, chunks[0].normals
+	} else {
+		positions = make([]float32, 0, total[0]*3)
+		uvs = make([]float32, 0, total[1]*2)
+		normals = make([]float32, 0, total[2]*3)
+		for _, chunk := range chunks {
+			positions = append(positions, chunk.positions...)
+			uvs = append(uvs, chunk.uvs...)
+			normals = append(normals, chunk.normals...)
+		}
+	}
+	for _, chunk := range chunks {
+		chunk.positions, chunk.uvs, chunk.normals = nil, nil, nil
+	}
+
+	errs := make([]error, len(chunks))
+	var wg sync.WaitGroup
+	for i := range chunks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = chunks[i].resolve(bases[i], total, positions)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return positions, uvs, normals, nil
 }
 
-func parseVec2(line string) []float32 {
-	parts := strings.Fields(line[3:])
-	u, _ := strconv.ParseFloat(parts[0], 32)
-	v, _ := strconv.ParseFloat(parts[1], 32)
-	return []float32{float32(u), float32(v)}
+// resolve makes the face indices of the chunk 0-based indices into the whole
+// file and splits its faces into triangles.
+func (c *objChunk) resolve(base, total [3]int, positions []float32) error {
+	for i := range c.corners {
+		for k := range c.corners[i] {
+			index, err := resolveIndex(c.corners[i][k], k, base[k], total[k])
+			if err != nil {
+				return c.cornerError(i, err)
+			}
+			c.corners[i][k] = index
+		}
+	}
+	c.faceLines, c.faceText = nil, nil
+
+	if c.sizes == nil {
+		for i := range c.changes {
+			c.changes[i].triangle = c.changes[i].face
+		}
+		return nil
+	}
+
+	triangles := make([]objCorner, 0, (len(c.corners)-2*c.faces)*3)
+	var triangulator triangulator
+	var polygon [][3]float32
+	change, offset := 0, 0
+
+	for face, size := range c.sizes {
+		for ; change < len(c.changes) && c.changes[change].face == face; change++ {
+			c.changes[change].triangle = len(triangles) / 3
+		}
+
+		corners := c.corners[offset : offset+int(size)]
+		offset += int(size)
+		if size == 3 {
+			triangles = append(triangles, corners...)
+			continue
+		}
+
+		polygon = polygon[:0]
+		for _, corner := range corners {
+			p := positions[corner[0]*3:]
+			polygon = append(polygon, [3]float32{p[0], p[1], p[2]})
+		}
+		for _, triangle := range triangulator.triangulate(polygon) {
+			triangles = append(triangles, corners[triangle[0]], corners[triangle[1]], corners[triangle[2]])
+		}
+	}
+	for ; change < len(c.changes); change++ {
+		c.changes[change].triangle = len(triangles) / 3
+	}
+
+	c.corners, c.sizes = triangles, nil
+	return nil
 }
 
-type FaceVertex struct {
-	Position int
-	UV       int
-	Normal   int
+// groupOBJChunks replays the group, material and smoothing statements of the
+// chunks in file order, sorting their triangles into groups.
+func groupOBJChunks(chunks []*objChunk) (groups []*objGroup, hasSmoothingGroups bool) {
+	groupLookup := make(map[[2]string]*objGroup)
+	var objectName, groupName, materialName string
+	var smoothing uint32 = 1
+	var current *objGroup
+
+	add := func(corners []objCorner) {
+		if len(corners) == 0 {
+			return
+		}
+		if current == nil {
+			name := objectName
+			if groupName != "" {
+				name = groupName
+			}
+
+			key := [2]string{name, materialName}
+			if current = groupLookup[key]; current == nil {
+				current = &objGroup{name: name, material: materialName}
+				groupLookup[key] = current
+				groups = append(groups, current)
+			}
+		}
+		current.ranges = append(current.ranges, objRange{corners: corners, smoothing: smoothing})
+		current.cornerCount += len(corners)
+	}
+
+	for _, chunk := range chunks {
+		start := 0
+		for _, change := range chunk.changes {
+			add(chunk.corners[start*3 : change.triangle*3])
+			start = change.triangle
+
+			switch change.keyword {
+			case "usemtl":
+				materialName = change.value
+				current = nil
+			case "o":
+				objectName = change.value
+				groupName = ""
+				current = nil
+			case "g":
+				groupName = change.value
+				current = nil
+			case "s":
+				hasSmoothingGroups = true
+				smoothing = change.smoothing
+			}
+		}
+		add(chunk.corners[start*3:])
+	}
+
+	return groups, hasSmoothingGroups
 }
 
-func parseFace(line string) []FaceVertex {
-	parts := strings.Fields(line[2:])
-	vertices := make([]FaceVertex, len(parts))
+func countCorners(groups []*objGroup) int {
+	count := 0
+	for _, group := range groups {
+		count += group.cornerCount
+	}
+	return count
+}
+
+// buildOBJ creates one vertex for every distinct combination of position,
+// texture coordinate and normal index. Vertices are chained per position
+// instead of hashed, which is far cheaper for large files.
+func buildOBJ(corners []objCorner, positions, uvs, normals []float32) *common.ObjectPrimitive {
+	positionCount := len(positions) / 3
+	obj := &common.ObjectPrimitive{
+		Vertices: make([]float32, 0, positionCount*3),
+		UVs:      make([]float32, 0, positionCount*2),
+		Normals:  make([]float32, 0, positionCount*3),
+		Indices:  make([]uint32, len(corners)),
+	}
 
-	for i, part := range parts {
-		indices := strings.Split(part, "/")
-		posIdx, _ := strconv.Atoi(indices[0])
-		uvIdx, _ := strconv.Atoi(indices[1])
-		normalIdx, _ := strconv.Atoi(indices[2])
+	first := make([]int32, positionCount)
+	for i := range first {
+		first[i] = -1
+	}
+	var keys []objCorner
+	var next []int32
 
-		vertices[i] = FaceVertex{
-			Position: posIdx,
-			UV:       uvIdx,
-			Normal:   normalIdx,
+	for i, corner := range corners {
+		vertex := first[corner[0]]
+		for vertex >= 0 && keys[vertex] != corner {
+			vertex = next[vertex]
 		}
+
+		if vertex < 0 {
+			vertex = int32(len(keys))
+			keys = append(keys, corner)
+			next = append(next, first[corner[0]])
+			first[corner[0]] = vertex
+
+			obj.Vertices = append(obj.Vertices, positions[corner[0]*3:corner[0]*3+3]...)
+			if corner[1] >= 0 {
+				obj.UVs = append(obj.UVs, uvs[corner[1]*2:corner[1]*2+2]...)
+			} else {
+				obj.UVs = append(obj.UVs, 0, 0)
+			}
+			obj.Normals = append(obj.Normals, normals[corner[2]*3:corner[2]*3+3]...)
+		}
+		obj.Indices[i] = uint32(vertex)
+	}
+
+	return obj
+}
+
+// buildOBJWithGeneratedNormals generates normals for the corners, keeping
+// those from the file where the mode allows, and merges identical vertices.
+func buildOBJWithGeneratedNormals(corners []objCorner, smoothing []uint32, positions, uvs, normals []float32, mode NormalMode) *common.ObjectPrimitive {
+	points := make([][3]float32, len(positions)/3)
+	for i := range points {
+		points[i] = [3]float32{positions[i*3], positions[i*3+1], positions[i*3+2]}
+	}
+
+	cornerPositions := make([]int, len(corners))
+	for i, corner := range corners {
+		cornerPositions[i] = int(corner[0])
+	}
+	generated := generateNormals(points, cornerPositions, smoothing, mode == NormalsFlat)
+
+	builder := newMeshBuilder()
+	builder.obj.Indices = make([]uint32, len(corners))
+
+	for i, corner := range corners {
+		vertex := Vertex{Position: points[corner[0]], Normal: generated[i]}
+		if corner[1] >= 0 {
+			vertex.UV = [2]float32{uvs[corner[1]*2], uvs[corner[1]*2+1]}
+		}
+		if corner[2] >= 0 && mode == NormalsFromFile {
+			vertex.Normal = [3]float32{normals[corner[2]*3], normals[corner[2]*3+1], normals[corner[2]*3+2]}
+		}
+
+		builder.obj.Indices[i] = builder.add(vertex)
+	}
+	return builder.obj
+}
+
+func needsGeneratedNormals(corners []objCorner, mode NormalMode) bool {
+	if mode != NormalsFromFile {
+		return true
+	}
+	for _, corner := range corners {
+		if corner[2] < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFloats reads the first n numbers from the fields of s. On failure it
+// returns the offending token alongside the error.
+func parseFloats(s string, n int) ([]float32, string, error) {
+	return parseFloatRange(s, n, n)
+}
+
+// parseFloatRange reads between min and max numbers from the fields of s.
+func parseFloatRange(s string, min, max int) ([]float32, string, error) {
+	parts := strings.Fields(s)
+	if len(parts) < min {
+		return nil, s, ErrMissingComponent
+	}
+
+	n := len(parts)
+	if n > max {
+		n = max
 	}
 
-	return vertices
+	values := make([]float32, n)
+	for i := 0; i < n; i++ {
+		value, err := strconv.ParseFloat(parts[i], 32)
+		if err != nil {
+			return nil, parts[i], err
+		}
+		values[i] = float32(value)
+	}
+	return values, "", nil
+}
+
+// FaceVertex holds the 1-based attribute indices of a single face corner.
+// UV and Normal are zero when the corner does not reference that attribute.
+type FaceVertex struct {
+	Position int
+	UV       int
+	Normal   int
 }
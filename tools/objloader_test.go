@@ -0,0 +1,349 @@
+package tools
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestFile writes content to name in a temporary directory and returns
+// its path.
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// objQuadLines returns the statements of a unit quad made of two triangles,
+// repeated so that parallel parsing splits it into several chunks.
+func objQuadLines(repeat int) []string {
+	var lines []string
+	for i := 0; i < repeat; i++ {
+		lines = append(lines,
+			"v 0 0 0", "v 1 0 0", "v 1 1 0", "v 0 1 0",
+			"vt 0 0", "vt 1 0", "vt 1 1", "vt 0 1",
+			"vn 0 0 1",
+			"f -4/-4/-1 -3/-3/-1 -2/-2/-1",
+			"f -4/-4/-1 -2/-2/-1 -1/-1/-1",
+		)
+	}
+	return lines
+}
+
+func TestOBJParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		line  int
+		token string
+		err   error
+	}{
+		{"missing position component", []string{"v 0 0 0", "v 1 0"}, 2, "1 0", ErrMissingComponent},
+		{"bad number", []string{"v 0 0 0", "vn 0 x 1"}, 2, "x", nil},
+		{"too few corners", []string{"v 0 0 0", "v 1 0 0", "f 1 2"}, 3, "f 1 2", ErrMissingComponent},
+		{"position out of range", []string{"v 0 0 0", "v 1 0 0", "v 1 1 0", "f 1 2 4"}, 4, "4", ErrIndexOutOfRange},
+		{"negative out of range", []string{"v 0 0 0", "v 1 0 0", "v 1 1 0", "f -1 -2 -4"}, 4, "-4", ErrIndexOutOfRange},
+		{"uv out of range", []string{"v 0 0 0", "v 1 0 0", "v 1 1 0", "vt 0 0", "f 1/1 2/2 3/1"}, 5, "2/2", ErrIndexOutOfRange},
+		{"zero index", []string{"v 0 0 0", "v 1 0 0", "v 1 1 0", "f 0 1 2"}, 4, "0", ErrIndexOutOfRange},
+		{"bad smoothing group", []string{"s x"}, 1, "x", nil},
+		// Far enough into the file to land in a later chunk when parsed in
+		// parallel, where indices are only checked once chunks are joined.
+		{"late index out of range", append(objQuadLines(20), "f 1 2 81"), 221, "81", ErrIndexOutOfRange},
+		{"late polygon out of range", append(objQuadLines(20), "f 1 2 3 900 4"), 221, "900", ErrIndexOutOfRange},
+		{"late negative out of range", append(objQuadLines(20), "f -1 -2 -81"), 221, "-81", ErrIndexOutOfRange},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, "bad.obj", strings.Join(test.lines, "\n")+"\n")
+		for _, workers := range []int{0, 4} {
+			_, err := CreateNewOBJWithOptions(path, OBJOptions{Workers: workers})
+
+			var parseErr *OBJParseError
+			if !errors.As(err, &parseErr) {
+				t.Errorf("%s (workers %d): got %v, want an *OBJParseError", test.name, workers, err)
+				continue
+			}
+			if parseErr.File != path || parseErr.Line != test.line || parseErr.Token != test.token {
+				t.Errorf("%s (workers %d): got %s:%d %q, want line %d %q", test.name, workers, parseErr.File, parseErr.Line, parseErr.Token, test.line, test.token)
+			}
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Errorf("%s (workers %d): got %v, want %v", test.name, workers, err, test.err)
+			}
+		}
+	}
+}
+
+// objCorners returns the position, texture coordinate and normal of every
+// triangle corner of obj, in index order.
+func objCorners(obj *common.ObjectPrimitive) (positions [][3]float32, uvs [][2]float32, normals [][3]float32) {
+	for _, index := range obj.Indices {
+		positions = append(positions, [3]float32{obj.Vertices[index*3], obj.Vertices[index*3+1], obj.Vertices[index*3+2]})
+		if int(index) < len(obj.UVs)/2 {
+			uvs = append(uvs, [2]float32{obj.UVs[index*2], obj.UVs[index*2+1]})
+		}
+		if int(index) < len(obj.Normals)/3 {
+			normals = append(normals, [3]float32{obj.Normals[index*3], obj.Normals[index*3+1], obj.Normals[index*3+2]})
+		}
+	}
+	return positions, uvs, normals
+}
+
+func TestOBJFaceForms(t *testing.T) {
+	header := []string{
+		"v 0 0 0", "v 1 0 0", "v 1 1 0",
+		"vt 0.25 0.75", "vt 0.5", "vt 1 1 0",
+		"vn 0 0 -1",
+	}
+	wantPositions := [][3]float32{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}}
+	wantUVs := [][2]float32{{0.25, 0.75}, {0.5, 0}, {1, 1}}
+	fileNormal := [3]float32{0, 0, -1}
+
+	tests := []struct {
+		face       string
+		hasUVs     bool
+		hasNormals bool
+	}{
+		{"f 1 2 3", false, false},
+		{"f 1/1 2/2 3/3", true, false},
+		{"f 1//1 2//1 3//1", false, true},
+		{"f 1/1/1 2/2/1 3/3/1", true, true},
+		{"f -3/-3/-1 -2/-2/-1 -1/-1/-1", true, true},
+		{"f -3//-1 2//1 -1//-1", false, true},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, "forms.obj", strings.Join(append(header, test.face), "\n")+"\n")
+		for _, workers := range []int{0, 4} {
+			obj, err := CreateNewOBJWithOptions(path, OBJOptions{Workers: workers})
+			if err != nil {
+				t.Errorf("%q (workers %d): %v", test.face, workers, err)
+				continue
+			}
+
+			positions, uvs, normals := objCorners(obj)
+			if !reflect.DeepEqual(positions, wantPositions) {
+				t.Errorf("%q (workers %d): positions %v, want %v", test.face, workers, positions, wantPositions)
+			}
+			if test.hasUVs && !reflect.DeepEqual(uvs, wantUVs) {
+				t.Errorf("%q (workers %d): texture coordinates %v, want %v", test.face, workers, uvs, wantUVs)
+			}
+			for _, normal := range normals {
+				// Without normals in the face the counter-clockwise triangle
+				// gets a generated one facing +z.
+				want := [3]float32{0, 0, 1}
+				if test.hasNormals {
+					want = fileNormal
+				}
+				if normal != want {
+					t.Errorf("%q (workers %d): normal %v, want %v", test.face, workers, normal, want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestOBJPolygonFaces(t *testing.T) {
+	lines := []string{
+		"v 0 0 0", "v 2 0 0", "v 2 1 0", "v 1 1 0", "v 1 2 0", "v 0 2 0",
+		"f 1 2 3 4 5 6",
+		"f 1 2 3",
+	}
+	obj, err := CreateNewOBJ(writeTestFile(t, "polygon.obj", strings.Join(lines, "\n")+"\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(obj.Indices) != 5*3 {
+		t.Errorf("got %d triangles, want 4 from the hexagon and 1 more", len(obj.Indices)/3)
+	}
+}
+
+func TestOBJSmoothingGroups(t *testing.T) {
+	fold := []string{"v 0 0 0", "v 1 0 0", "v 0 1 0", "v 0 0 -1"}
+	tests := []struct {
+		name     string
+		faces    []string
+		mode     NormalMode
+		vertices int
+	}{
+		{"no groups", []string{"f 1 2 3", "f 2 1 4"}, NormalsFromFile, 4},
+		{"same group", []string{"s 1", "f 1 2 3", "f 2 1 4"}, NormalsSmooth, 4},
+		{"different groups", []string{"s 1", "f 1 2 3", "s 2", "f 2 1 4"}, NormalsSmooth, 6},
+		{"smoothing off", []string{"s off", "f 1 2 3", "f 2 1 4"}, NormalsFromFile, 6},
+		{"flat", []string{"s 1", "f 1 2 3", "f 2 1 4"}, NormalsFlat, 6},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, "fold.obj", strings.Join(append(fold, test.faces...), "\n")+"\n")
+		obj, err := CreateNewOBJWithOptions(path, OBJOptions{Normals: test.mode})
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if vertices := len(obj.Vertices) / 3; vertices != test.vertices {
+			t.Errorf("%s: got %d vertices, want %d", test.name, vertices, test.vertices)
+		}
+	}
+}
+
+func TestOBJSubmeshes(t *testing.T) {
+	// Each face has its own vertices, with x set to the face's number, so
+	// the faces of each submesh can be told apart.
+	var vertices []string
+	for face := 0; face < 7; face++ {
+		vertices = append(vertices, fmt.Sprintf("v %d 0 0", face), fmt.Sprintf("v %d 1 0", face), fmt.Sprintf("v %d 0 1", face))
+	}
+	face := func(n int) string { return fmt.Sprintf("f %d %d %d", n*3+1, n*3+2, n*3+3) }
+	lines := append(vertices,
+		"mtllib scene.mtl",
+		"o table", "usemtl wood", face(0),
+		"g legs", face(1),
+		"usemtl metal", face(2),
+		"g top", "usemtl wood", face(3),
+		// Switching back continues the earlier submeshes.
+		"g legs", "usemtl metal", face(4),
+		"usemtl wood", face(5),
+		// A new object clears the group name.
+		"o chair", face(6),
+	)
+	path := writeTestFile(t, "scene.obj", strings.Join(lines, "\n")+"\n")
+
+	want := []common.Submesh{
+		{Name: "table", Material: "wood", IndexOffset: 0, IndexCount: 3},
+		{Name: "legs", Material: "wood", IndexOffset: 3, IndexCount: 6},
+		{Name: "legs", Material: "metal", IndexOffset: 9, IndexCount: 6},
+		{Name: "top", Material: "wood", IndexOffset: 15, IndexCount: 3},
+		{Name: "chair", Material: "wood", IndexOffset: 18, IndexCount: 3},
+	}
+	wantFaces := [][]float32{{0}, {1, 5}, {2, 4}, {3}, {6}}
+
+	for _, workers := range []int{0, 4} {
+		obj, err := CreateNewOBJWithOptions(path, OBJOptions{Workers: workers})
+		if err != nil {
+			t.Fatalf("workers %d: %v", workers, err)
+		}
+		if want := filepath.Join(filepath.Dir(path), "scene.mtl"); obj.MaterialLib != want {
+			t.Errorf("workers %d: material library %q, want %q", workers, obj.MaterialLib, want)
+		}
+		if !reflect.DeepEqual(obj.Submeshes, want) {
+			t.Errorf("workers %d: submeshes %v, want %v", workers, obj.Submeshes, want)
+			continue
+		}
+
+		positions, _, _ := objCorners(obj)
+		for i, submesh := range obj.Submeshes {
+			var faces []float32
+			for corner := submesh.IndexOffset; corner < submesh.IndexOffset+submesh.IndexCount; corner += 3 {
+				faces = append(faces, positions[corner][0])
+			}
+			if !reflect.DeepEqual(faces, wantFaces[i]) {
+				t.Errorf("workers %d: submesh %s/%s has faces %v, want %v", workers, submesh.Name, submesh.Material, faces, wantFaces[i])
+			}
+		}
+	}
+}
+
+func TestOBJMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.obj")
+	for _, workers := range []int{0, 4} {
+		if _, err := CreateNewOBJWithOptions(path, OBJOptions{Workers: workers}); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("workers %d: got %v, want os.ErrNotExist", workers, err)
+		}
+	}
+}
+
+func TestOBJMaterialLibOverride(t *testing.T) {
+	path := writeTestFile(t, "scene.obj", "mtllib scene.mtl\nv 0 0 0\nv 1 0 0\nv 1 1 0\nf 1 2 3\n")
+	tests := []struct {
+		name    string
+		mtlPath string
+		want    string
+	}{
+		{"from file", "", filepath.Join(filepath.Dir(path), "scene.mtl")},
+		{"override", "/materials/other.mtl", "/materials/other.mtl"},
+	}
+
+	for _, test := range tests {
+		obj, err := CreateNewOBJ(path, test.mtlPath)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if obj.MaterialLib != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, obj.MaterialLib, test.want)
+		}
+	}
+}
+
+// writeOBJGrid writes an n by n grid of quads with a texture coordinate and a
+// normal for every vertex, the same model objbench generates, and returns
+// its path and size.
+func writeOBJGrid(tb testing.TB, n int) (string, int64) {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "grid.obj")
+	file, err := os.Create(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	out := bufio.NewWriter(file)
+
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			fmt.Fprintf(out, "v %f %f %f\n", float64(x)*0.01, float64(y)*0.01, float64((x*y)%7)*0.1)
+		}
+	}
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			fmt.Fprintf(out, "vt %f %f\n", float64(x)/float64(n), float64(y)/float64(n))
+		}
+	}
+	for i := 0; i < (n+1)*(n+1); i++ {
+		fmt.Fprintf(out, "vn %f %f %f\n", 0.0, 0.0, 1.0)
+	}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			a := y*(n+1) + x + 1
+			b, c, d := a+1, a+n+2, a+n+1
+			fmt.Fprintf(out, "f %d/%d/%d %d/%d/%d %d/%d/%d %d/%d/%d\n", a, a, a, b, b, b, c, c, c, d, d, d)
+		}
+	}
+
+	if err := out.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return path, info.Size()
+}
+
+func BenchmarkOBJLoad(b *testing.B) {
+	path, size := writeOBJGrid(b, 300)
+	for _, workers := range []int{0, 4} {
+		name := "stream"
+		if workers > 1 {
+			name = fmt.Sprintf("workers-%d", workers)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				if _, err := CreateNewOBJWithOptions(path, OBJOptions{Workers: workers}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,452 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// objCorner holds the position, texture coordinate and normal indices of a
+// face corner. While a chunk is parsed, positive values are the 1-based
+// indices written in the file, values below zero are chunk-relative (see
+// objRelativeBias) and zero marks an absent attribute. Once resolved they are
+// 0-based indices into the whole file, with -1 for an absent attribute.
+type objCorner [3]int32
+
+// objRelativeBias is subtracted from chunk-relative indices so they cannot
+// be mistaken for absolute ones. Negative indices count back from the end of
+// the attributes read so far, which a chunk parsed on its own only knows
+// relative to its own start.
+const objRelativeBias = 1 << 30
+
+// objStateChange records a statement that changes which group, material or
+// smoothing group the faces after it belong to.
+type objStateChange struct {
+	face      int // faces of the chunk read before the statement
+	triangle  int // triangles of the chunk before the statement, once triangulated
+	keyword   string
+	value     string
+	smoothing uint32
+}
+
+// objChunk holds what was parsed from one run of lines of an OBJ file, in
+// flat arrays. A streamed file is parsed as a single chunk; in parallel mode
+// the file is split at line boundaries and every chunk is parsed on its own,
+// then the chunks are stitched together by resolveOBJChunks.
+type objChunk struct {
+	file string
+	// strict checks face indices as they are read. Only a chunk starting at
+	// the top of the file knows every attribute a face may refer to.
+	strict bool
+
+	positions []float32
+	uvs       []float32
+	normals   []float32
+
+	corners []objCorner
+	sizes   []int32 // corners per face; nil while every face is a triangle
+	faces   int
+
+	changes     []objStateChange
+	materialLib string
+	lines       int
+
+	// firstLine is the number of lines of the file before the chunk. A
+	// chunk that is not strict keeps the line number and text of each face,
+	// so that an index found out of range once the chunks are joined can be
+	// reported where it was written.
+	firstLine int
+	faceLines []int32
+	faceText  [][]byte
+}
+
+func (c *objChunk) fail(token string, err error) error {
+	return &OBJParseError{File: c.file, Line: c.lines, Token: token, Err: err}
+}
+
+// parseLines parses every line of data, which must end at a line boundary.
+func (c *objChunk) parseLines(data []byte) error {
+	for len(data) > 0 {
+		end := 0
+		for end < len(data) && data[end] != '\n' {
+			end++
+		}
+		line := data[:end]
+		if end < len(data) {
+			end++
+		}
+		data = data[end:]
+
+		if err := c.parseLine(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseLine parses a single statement. Numbers are parsed straight from the
+// line so that vertex and face statements do not allocate.
+func (c *objChunk) parseLine(line []byte) error {
+	c.lines++
+
+	keyword, rest := nextField(line)
+	if len(keyword) == 0 || keyword[0] == '#' {
+		return nil
+	}
+
+	switch string(keyword) {
+	case "v":
+		return c.parseVector(&c.positions, rest, 3, 3)
+	case "vt":
+		// v is optional for 1D texture coordinates and defaults to 0.
+		return c.parseVector(&c.uvs, rest, 1, 2)
+	case "vn":
+		return c.parseVector(&c.normals, rest, 3, 3)
+	case "f":
+		return c.parseFace(rest)
+	case "mtllib":
+		// Only the first library is kept; exporters write a single one.
+		if c.materialLib == "" {
+			c.materialLib = string(trimSpace(rest))
+		}
+	case "usemtl", "o", "g":
+		c.changes = append(c.changes, objStateChange{face: c.faces, keyword: string(keyword), value: string(trimSpace(rest))})
+	case "s":
+		value := string(trimSpace(rest))
+		change := objStateChange{face: c.faces, keyword: "s", value: value}
+		if value != "off" {
+			group, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return c.fail(value, err)
+			}
+			change.smoothing = uint32(group)
+		}
+		c.changes = append(c.changes, change)
+	}
+	return nil
+}
+
+// parseVector appends between min and max numbers from the fields of rest to
+// values, padding missing optional components with zero.
+func (c *objChunk) parseVector(values *[]float32, rest []byte, min, max int) error {
+	fields := rest
+	for i := 0; i < max; i++ {
+		var field []byte
+		field, fields = nextField(fields)
+		if len(field) == 0 {
+			if i < min {
+				*values = (*values)[:len(*values)-i]
+				return c.fail(string(trimSpace(rest)), ErrMissingComponent)
+			}
+			*values = append(*values, 0)
+			continue
+		}
+
+		value, err := parseFloat32(field)
+		if err != nil {
+			*values = (*values)[:len(*values)-i]
+			return c.fail(string(field), err)
+		}
+		*values = append(*values, value)
+	}
+	return nil
+}
+
+// parseFace reads every corner of an "f" statement in any of the forms v,
+// v/vt, v//vn or v/vt/vn.
+func (c *objChunk) parseFace(rest []byte) error {
+	start := len(c.corners)
+	counts := [3]int{len(c.positions) / 3, len(c.uvs) / 2, len(c.normals) / 3}
+
+	for field, fields := nextField(rest); len(field) > 0; field, fields = nextField(fields) {
+		var corner objCorner
+		component := 0
+		for begin, i := 0, 0; i <= len(field); i++ {
+			if i < len(field) && field[i] != '/' {
+				continue
+			}
+			if component == 3 {
+				c.corners = c.corners[:start]
+				return c.fail(string(field), ErrMissingComponent)
+			}
+
+			index, err := c.faceIndex(field[begin:i], counts[component])
+			if err == nil && component == 0 && index == 0 {
+				err = ErrMissingComponent
+			}
+			if err != nil {
+				c.corners = c.corners[:start]
+				return c.fail(string(field), err)
+			}
+
+			corner[component] = index
+			component++
+			begin = i + 1
+		}
+		c.corners = append(c.corners, corner)
+	}
+
+	n := len(c.corners) - start
+	if n < 3 {
+		c.corners = c.corners[:start]
+		return c.fail("f "+string(trimSpace(rest)), ErrMissingComponent)
+	}
+
+	if n != 3 && c.sizes == nil {
+		c.sizes = make([]int32, c.faces, c.faces+1)
+		for i := range c.sizes {
+			c.sizes[i] = 3
+		}
+	}
+	if c.sizes != nil {
+		c.sizes = append(c.sizes, int32(n))
+	}
+	if !c.strict {
+		c.faceLines = append(c.faceLines, int32(c.lines))
+		c.faceText = append(c.faceText, rest)
+	}
+	c.faces++
+	return nil
+}
+
+// faceIndex converts a single face index, given the number of attributes of
+// its kind the chunk has read so far. An empty field yields 0, meaning the
+// attribute is absent.
+func (c *objChunk) faceIndex(field []byte, count int) (int32, error) {
+	if len(field) == 0 {
+		return 0, nil
+	}
+
+	index, ok := parseInt(field)
+	if !ok {
+		if _, err := strconv.Atoi(string(field)); err != nil {
+			return 0, err
+		}
+		return 0, ErrIndexOutOfRange
+	}
+
+	switch {
+	case index > 0:
+		if index >= objRelativeBias || (c.strict && index > count) {
+			return 0, ErrIndexOutOfRange
+		}
+		return int32(index), nil
+	case index < 0:
+		local := count + index + 1
+		if local <= -objRelativeBias || (c.strict && local < 1) {
+			return 0, ErrIndexOutOfRange
+		}
+		return int32(local - objRelativeBias), nil
+	default:
+		return 0, ErrIndexOutOfRange
+	}
+}
+
+var objAttributeNames = [3]string{"position", "texture coordinate", "normal"}
+
+// resolveIndex turns component k of a parsed corner into a 0-based index,
+// given the number of attributes of its kind in the chunks before this one
+// and in the whole file.
+func resolveIndex(index int32, k, base, total int) (int32, error) {
+	global := int(index)
+	switch {
+	case index == 0:
+		return -1, nil
+	case index < 0:
+		global = base + int(index) + objRelativeBias
+	}
+
+	if global < 1 || global > total {
+		return 0, fmt.Errorf("%s %d of %d: %w", objAttributeNames[k], global, total, ErrIndexOutOfRange)
+	}
+	return int32(global - 1), nil
+}
+
+// cornerError reports an index of corner i of the chunk that is out of range
+// as an *OBJParseError at the face it was read from.
+func (c *objChunk) cornerError(i int, err error) error {
+	face, corner := i/3, i%3
+	if c.sizes != nil {
+		face, corner = 0, i
+		for corner >= int(c.sizes[face]) {
+			corner -= int(c.sizes[face])
+			face++
+		}
+	}
+	if face >= len(c.faceLines) {
+		return &OBJParseError{File: c.file, Line: c.firstLine + c.lines, Err: err}
+	}
+
+	field, fields := nextField(c.faceText[face])
+	for ; corner > 0; corner-- {
+		field, fields = nextField(fields)
+	}
+	return &OBJParseError{File: c.file, Line: c.firstLine + int(c.faceLines[face]), Token: string(field), Err: err}
+}
+
+// nextField returns the first whitespace separated field of s and what
+// follows it.
+func nextField(s []byte) (field, rest []byte) {
+	start := 0
+	for start < len(s) && isSpace(s[start]) {
+		start++
+	}
+	end := start
+	for end < len(s) && !isSpace(s[end]) {
+		end++
+	}
+	return s[start:end], s[end:]
+}
+
+func trimSpace(s []byte) []byte {
+	for len(s) > 0 && isSpace(s[0]) {
+		s = s[1:]
+	}
+	for len(s) > 0 && isSpace(s[len(s)-1]) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\v' || c == '\f'
+}
+
+// float64Pow10 holds the powers of ten that are exact in a float64.
+var float64Pow10 = [...]float64{
+	1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11,
+	1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22,
+}
+
+// parseFloat32 parses a decimal number the way strconv.ParseFloat(s, 32)
+// does, and returns the same result, but without converting s to a string.
+// Numbers with up to 15 significant digits and a small exponent, which is
+// what exporters write, take an exact fast path; anything else, including
+// malformed input, is handed to strconv.
+func parseFloat32(s []byte) (float32, error) {
+	if value, ok := parseFloat32Fast(s); ok {
+		return value, nil
+	}
+	value, err := strconv.ParseFloat(string(s), 32)
+	return float32(value), err
+}
+
+func parseFloat32Fast(s []byte) (float32, bool) {
+	i := 0
+	negative := false
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		negative = s[i] == '-'
+		i++
+	}
+
+	var mantissa uint64
+	exponent, significant := 0, 0
+	sawDigits, sawDot := false, false
+	for ; i < len(s); i++ {
+		c := s[i]
+		if c == '.' && !sawDot {
+			sawDot = true
+			continue
+		}
+		if c < '0' || c > '9' {
+			break
+		}
+
+		sawDigits = true
+		if significant == 19 {
+			return 0, false
+		}
+		mantissa = mantissa*10 + uint64(c-'0')
+		if mantissa != 0 {
+			significant++
+		}
+		if sawDot {
+			exponent--
+		}
+	}
+	if !sawDigits {
+		return 0, false
+	}
+
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		sign := 1
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			if s[i] == '-' {
+				sign = -1
+			}
+			i++
+		}
+		if i == len(s) {
+			return 0, false
+		}
+
+		e := 0
+		for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+			if e > 1000 {
+				return 0, false
+			}
+			e = e*10 + int(s[i]-'0')
+		}
+		exponent += sign * e
+	}
+	if i != len(s) {
+		return 0, false
+	}
+
+	if mantissa == 0 {
+		if negative {
+			return float32(math.Copysign(0, -1)), true
+		}
+		return 0, true
+	}
+	if mantissa >= 1<<53 || exponent < -22 || exponent > 22 {
+		return 0, false
+	}
+
+	// Both operands are exact, so this is the correctly rounded float64.
+	value := float64(mantissa)
+	if exponent < 0 {
+		value /= float64Pow10[-exponent]
+	} else {
+		value *= float64Pow10[exponent]
+	}
+
+	// Rounding once more to float32 only differs from rounding the decimal
+	// directly when the float64 landed exactly halfway between two float32s.
+	if math.Float64bits(value)&(1<<29-1) == 1<<28 {
+		return 0, false
+	}
+
+	result := float32(value)
+	if negative {
+		result = -result
+	}
+	return result, true
+}
+
+// parseInt parses a decimal integer of at most nine digits, reporting false
+// for anything else.
+func parseInt(s []byte) (int, bool) {
+	i := 0
+	negative := false
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		negative = s[i] == '-'
+		i++
+	}
+	if i == len(s) || len(s)-i > 9 {
+		return 0, false
+	}
+
+	value := 0
+	for ; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		value = value*10 + int(s[i]-'0')
+	}
+	if negative {
+		value = -value
+	}
+	return value, true
+}
@@ -0,0 +1,324 @@
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"github.com/go-gl/mathgl/mgl32"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SaveOBJ writes obj to modelFPath so it can be inspected or edited in other
+// tools. When mtlFPath is set, the materials of obj are written there and
+// referenced with mtllib; materials that obj only names through MaterialLib
+// are read from that library first. Without mtlFPath the existing MaterialLib
+// is referenced instead.
+func SaveOBJ(modelFPath, mtlFPath string, obj *common.ObjectPrimitive) error {
+	materialLib := obj.MaterialLib
+
+	if mtlFPath != "" {
+		materials := obj.Materials
+		if materials == nil && obj.MaterialLib != "" {
+			var err error
+			if materials, err = ParseMTL(obj.MaterialLib); err != nil {
+				return err
+			}
+		}
+		if err := SaveMTL(mtlFPath, materials); err != nil {
+			return err
+		}
+		materialLib = mtlFPath
+	}
+
+	if materialLib != "" {
+		if relative, err := filepath.Rel(filepath.Dir(modelFPath), materialLib); err == nil {
+			materialLib = relative
+		}
+		materialLib = filepath.ToSlash(materialLib)
+	}
+
+	file, err := os.Create(modelFPath)
+	if err != nil {
+		return err
+	}
+	if err := WriteOBJ(file, obj, materialLib); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WriteOBJ writes obj as OBJ text. Every vertex gets its own v, vt and vn
+// statement, so indices are kept as they are; vt and vn are left out when obj
+// has no texture coordinates or normals. Each submesh is written as a group
+// with its material. materialLib, if set, is written as the mtllib statement.
+func WriteOBJ(w io.Writer, obj *common.ObjectPrimitive, materialLib string) error {
+	obj.SplitInterleaved()
+	out := bufio.NewWriter(w)
+	vertexCount := len(obj.Vertices) / 3
+	hasUVs := len(obj.UVs) >= vertexCount*2 && vertexCount > 0
+	hasNormals := len(obj.Normals) >= vertexCount*3 && vertexCount > 0
+
+	if materialLib != "" {
+		fmt.Fprintf(out, "mtllib %s\n", materialLib)
+	}
+
+	// Numbers are formatted by hand; fmt is far slower on large meshes.
+	var line []byte
+	writeFloats := func(keyword string, values []float32) {
+		line = append(line[:0], keyword...)
+		for _, value := range values {
+			line = append(line, ' ')
+			line = strconv.AppendFloat(line, float64(value), 'g', -1, 32)
+		}
+		line = append(line, '\n')
+		out.Write(line)
+	}
+
+	for v := 0; v < vertexCount; v++ {
+		writeFloats("v", obj.Vertices[v*3:v*3+3])
+	}
+	if hasUVs {
+		for v := 0; v < vertexCount; v++ {
+			writeFloats("vt", obj.UVs[v*2:v*2+2])
+		}
+	}
+	if hasNormals {
+		for v := 0; v < vertexCount; v++ {
+			writeFloats("vn", obj.Normals[v*3:v*3+3])
+		}
+	}
+
+	submeshes := obj.Submeshes
+	if len(submeshes) == 0 {
+		submeshes = []common.Submesh{{IndexCount: len(obj.Indices)}}
+	}
+
+	// The loader keeps the current group and material until they are named
+	// again, so an unnamed submesh after a named one needs a placeholder.
+	var groupName, materialName string
+	for _, submesh := range submeshes {
+		name := submesh.Name
+		if name == "" && groupName != "" {
+			name = "default"
+		}
+		if name != groupName {
+			fmt.Fprintf(out, "g %s\n", name)
+			groupName = name
+		}
+
+		material := submesh.Material
+		if material == "" && materialName != "" {
+			material = "default"
+		}
+		if material != materialName {
+			fmt.Fprintf(out, "usemtl %s\n", material)
+			materialName = material
+		}
+
+		end := submesh.IndexOffset + submesh.IndexCount
+		if submesh.IndexOffset < 0 || end > len(obj.Indices) {
+			return fmt.Errorf("submesh %q: %w", submesh.Name, ErrIndexOutOfRange)
+		}
+		for i := submesh.IndexOffset; i+2 < end; i += 3 {
+			line = append(line[:0], 'f')
+			for _, index := range obj.Indices[i : i+3] {
+				if int(index) >= vertexCount {
+					return fmt.Errorf("submesh %q: vertex %d: %w", submesh.Name, index, ErrIndexOutOfRange)
+				}
+				number := strconv.FormatUint(uint64(index)+1, 10)
+				line = append(line, ' ')
+				line = append(line, number...)
+				switch {
+				case hasUVs && hasNormals:
+					line = append(line, '/')
+					line = append(line, number...)
+					line = append(line, '/')
+					line = append(line, number...)
+				case hasUVs:
+					line = append(line, '/')
+					line = append(line, number...)
+				case hasNormals:
+					line = append(line, "//"...)
+					line = append(line, number...)
+				}
+			}
+			line = append(line, '\n')
+			out.Write(line)
+		}
+	}
+
+	return out.Flush()
+}
+
+// SaveMTL writes materials to mtlFPath. Texture paths are written relative to
+// the library, and textures embedded in the model (as by glTF) are saved as
+// image files beside it.
+func SaveMTL(mtlFPath string, materials map[string]*common.Material) error {
+	directory := filepath.Dir(mtlFPath)
+	base := strings.TrimSuffix(filepath.Base(mtlFPath), filepath.Ext(mtlFPath))
+
+	// glTF packs roughness and metallic into one image, so the same data
+	// is written only once.
+	written := make(map[*byte]string)
+
+	exported := make(map[string]*common.Material, len(materials))
+	for name, material := range materials {
+		copied := *material
+		for _, entry := range materialTextureMaps(&copied) {
+			textureMap := entry.textureMap
+			if len(textureMap.Embedded) > 0 {
+				path, found := written[&textureMap.Embedded[0]]
+				if !found {
+					path = filepath.Join(directory, embeddedTextureName(base, name, entry.keyword, textureMap.Embedded))
+					if err := os.WriteFile(path, textureMap.Embedded, 0644); err != nil {
+						return err
+					}
+					written[&textureMap.Embedded[0]] = path
+				}
+				textureMap.Path = path
+				textureMap.Embedded = nil
+			}
+			if textureMap.Path != "" {
+				if relative, err := filepath.Rel(directory, textureMap.Path); err == nil {
+					textureMap.Path = relative
+				}
+			}
+		}
+		exported[name] = &copied
+	}
+
+	file, err := os.Create(mtlFPath)
+	if err != nil {
+		return err
+	}
+	if err := WriteMTL(file, exported); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WriteMTL writes materials as MTL text, sorted by name. Every property read
+// by ParseMTL is written, including texture options. Texture paths are
+// written as they are; maps that exist only as embedded data are skipped.
+// OcclusionMap has no MTL statement and is not written.
+func WriteMTL(w io.Writer, materials map[string]*common.Material) error {
+	out := bufio.NewWriter(w)
+
+	names := make([]string, 0, len(materials))
+	for name := range materials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		material := materials[name]
+		if i > 0 {
+			out.WriteString("\n")
+		}
+
+		fmt.Fprintf(out, "newmtl %s\n", name)
+		fmt.Fprintf(out, "Ka %s\n", formatColor(material.Ambient))
+		fmt.Fprintf(out, "Kd %s\n", formatColor(material.Diffuse))
+		fmt.Fprintf(out, "Ks %s\n", formatColor(material.Specular))
+		fmt.Fprintf(out, "Ke %s\n", formatColor(material.Emissive))
+		fmt.Fprintf(out, "Ns %s\n", formatFloat(material.Shininess))
+		fmt.Fprintf(out, "d %s\n", formatFloat(material.Dissolve))
+		// Pr and Pm would make ParseMTL read the material back as PBR.
+		if material.PBR {
+			fmt.Fprintf(out, "Pr %s\n", formatFloat(material.Roughness))
+			fmt.Fprintf(out, "Pm %s\n", formatFloat(material.Metallic))
+		}
+		fmt.Fprintf(out, "illum %d\n", material.Illum)
+
+		for _, entry := range materialTextureMaps(material) {
+			if entry.textureMap.Path == "" {
+				continue
+			}
+			fmt.Fprintf(out, "%s %s\n", entry.keyword, formatTextureMap(*entry.textureMap))
+		}
+	}
+
+	return out.Flush()
+}
+
+type mtlTextureMap struct {
+	keyword    string
+	textureMap *common.TextureMap
+}
+
+// materialTextureMaps pairs each texture map of material with the MTL
+// statement that ParseMTL reads it from.
+func materialTextureMaps(material *common.Material) []mtlTextureMap {
+	return []mtlTextureMap{
+		{"map_Ka", &material.AmbientMap},
+		{"map_Kd", &material.DiffuseMap},
+		{"map_Ks", &material.SpecularMap},
+		{"map_Ke", &material.EmissiveMap},
+		{"map_d", &material.AlphaMap},
+		{"map_Bump", &material.NormalMap},
+		{"map_Pr", &material.RoughnessMap},
+		{"map_Pm", &material.MetallicMap},
+	}
+}
+
+// formatTextureMap writes the options of textureMap that differ from their
+// defaults, followed by its path with forward slashes. A zero scale component
+// or bump multiplier, as left by a map that was never given options, is taken
+// as the default of 1, as the renderer does.
+func formatTextureMap(textureMap common.TextureMap) string {
+	var options []string
+	scale := textureMap.Scale
+	for i := range scale {
+		if scale[i] == 0 {
+			scale[i] = 1
+		}
+	}
+	if scale != (mgl32.Vec3{1, 1, 1}) {
+		options = append(options, "-s "+formatColor(scale))
+	}
+	if textureMap.Offset != (mgl32.Vec3{}) {
+		options = append(options, "-o "+formatColor(textureMap.Offset))
+	}
+	if textureMap.Clamp {
+		options = append(options, "-clamp on")
+	}
+	if textureMap.BumpMultiplier != 1 && textureMap.BumpMultiplier != 0 {
+		options = append(options, "-bm "+formatFloat(textureMap.BumpMultiplier))
+	}
+	return strings.Join(append(options, filepath.ToSlash(textureMap.Path)), " ")
+}
+
+// embeddedTextureName picks a file name for an embedded image from the
+// library, material and map it belongs to, with an extension matching its
+// contents.
+func embeddedTextureName(library, material, keyword string, data []byte) string {
+	extension := ".png"
+	if http.DetectContentType(data) == "image/jpeg" {
+		extension = ".jpg"
+	}
+
+	name := library + "_" + material + "_" + strings.TrimPrefix(keyword, "map_")
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>| `, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	return name + extension
+}
+
+func formatColor(color mgl32.Vec3) string {
+	return formatFloat(color[0]) + " " + formatFloat(color[1]) + " " + formatFloat(color[2])
+}
+
+func formatFloat(value float32) string {
+	return strconv.FormatFloat(float64(value), 'g', -1, 32)
+}
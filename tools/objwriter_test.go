@@ -0,0 +1,85 @@
+package tools
+
+import (
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"github.com/go-gl/mathgl/mgl32"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOBJWriterRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	paper := common.NewMaterial("paper")
+	paper.Diffuse = mgl32.Vec3{0.9, 0.85, 0.7}
+	paper.Specular = mgl32.Vec3{0.1, 0.1, 0.1}
+	paper.Shininess = 12
+	paper.Illum = 2
+	paper.DiffuseMap = common.NewTextureMap(filepath.Join(dir, "textures", "paper.png"))
+	paper.DiffuseMap.Scale = mgl32.Vec3{2, 2, 1}
+	paper.DiffuseMap.Offset = mgl32.Vec3{0.5, 0, 0}
+	paper.DiffuseMap.Clamp = true
+
+	ink := common.NewMaterial("ink")
+	ink.PBR = true
+	ink.Roughness = 0.25
+	ink.Metallic = 1
+	ink.NormalMap = common.NewTextureMap(filepath.Join(dir, "ink_normal.png"))
+	ink.NormalMap.BumpMultiplier = 0.5
+
+	obj := testQuad()
+	obj.Materials = map[string]*common.Material{"paper": paper, "ink": ink}
+
+	objPath, mtlPath := filepath.Join(dir, "quad.obj"), filepath.Join(dir, "quad.mtl")
+	if err := SaveOBJ(objPath, mtlPath, obj); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := CreateNewOBJ(objPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.MaterialLib != mtlPath {
+		t.Errorf("material library: got %q, want %q", loaded.MaterialLib, mtlPath)
+	}
+
+	positions, uvs, normals := objCorners(loaded)
+	wantPositions, wantUVs, wantNormals := objCorners(obj)
+	if !reflect.DeepEqual(positions, wantPositions) || !reflect.DeepEqual(uvs, wantUVs) || !reflect.DeepEqual(normals, wantNormals) {
+		t.Errorf("corners: got %v %v %v, want %v %v %v", positions, uvs, normals, wantPositions, wantUVs, wantNormals)
+	}
+	if !reflect.DeepEqual(loaded.Submeshes, obj.Submeshes) {
+		t.Errorf("submeshes: got %v, want %v", loaded.Submeshes, obj.Submeshes)
+	}
+
+	materials, err := ParseMTL(loaded.MaterialLib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range obj.Materials {
+		if got := materials[name]; !reflect.DeepEqual(got, want) {
+			t.Errorf("material %s: got %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func TestFormatTextureMapDefaults(t *testing.T) {
+	scaled := common.TextureMap{Path: "a.png", Scale: mgl32.Vec3{2, 0, 0}, BumpMultiplier: 0.5}
+	tests := []struct {
+		name       string
+		textureMap common.TextureMap
+		want       string
+	}{
+		{"defaults", common.NewTextureMap("a.png"), "a.png"},
+		{"zero value", common.TextureMap{Path: "a.png"}, "a.png"},
+		{"material default", common.NewMaterial("m").NormalMap, ""},
+		{"zero components", scaled, "-s 2 1 1 -bm 0.5 a.png"},
+	}
+
+	for _, test := range tests {
+		if got := formatTextureMap(test.textureMap); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package tools
+
+import (
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"math"
+)
+
+// DefaultCacheSize is the post-transform vertex cache size assumed when
+// OptimizeOptions leaves it unset. Tipsify orders for this size, and a
+// slightly smaller size than the hardware has does little harm.
+const DefaultCacheSize = 16
+
+// OptimizeOptions controls OptimizeMesh.
+type OptimizeOptions struct {
+	// CacheSize is the number of entries of the simulated FIFO vertex cache.
+	CacheSize int
+	// Weld merges vertices whose positions, texture coordinates, normals and
+	// tangents all differ by no more than WeldTolerance on every component.
+	Weld          bool
+	WeldTolerance float32
+}
+
+// OptimizeStats reports the effect of OptimizeMesh. ACMR is the average
+// number of cache misses per triangle: 3 means no reuse at all, while well
+// ordered meshes get close to 0.5.
+type OptimizeStats struct {
+	ACMRBefore     float64
+	ACMRAfter      float64
+	VerticesBefore int
+	VerticesAfter  int
+}
+
+// OptimizeMesh reorders the triangles of every submesh of obj for the
+// post-transform vertex cache using Tipsify (Sander, Nehab and Barczak,
+// "Fast Triangle Reordering for Vertex Locality and Reduced Overdraw"),
+// then renumbers the vertices in the order they are first used so that
+// vertex fetches are sequential. Triangles never move between submeshes.
+// Vertices that no triangle uses are dropped. With Weld set, near-duplicate
+// vertices are merged first and the triangles this collapses are removed.
+func OptimizeMesh(obj *common.ObjectPrimitive, options OptimizeOptions) OptimizeStats {
+	obj.SplitInterleaved()
+	cacheSize := options.CacheSize
+	if cacheSize <= 0 {
+		cacheSize = DefaultCacheSize
+	}
+
+	stats := OptimizeStats{
+		ACMRBefore:     ACMR(obj.Indices, cacheSize),
+		VerticesBefore: len(obj.Vertices) / 3,
+	}
+
+	submeshes := obj.Submeshes
+	if len(submeshes) == 0 {
+		submeshes = []common.Submesh{{IndexCount: len(obj.Indices)}}
+	}
+
+	if options.Weld {
+		remap := weldVertices(obj, options.WeldTolerance)
+		for i, index := range obj.Indices {
+			obj.Indices[i] = remap[index]
+		}
+		submeshes = removeDegenerateTriangles(obj, submeshes)
+	}
+
+	vertexCount := len(obj.Vertices) / 3
+	tipsify := newTipsifier(vertexCount, cacheSize)
+	for _, submesh := range submeshes {
+		indices := obj.Indices[submesh.IndexOffset : submesh.IndexOffset+submesh.IndexCount]
+		copy(indices, tipsify.order(indices))
+	}
+
+	reorderVertices(obj)
+	if len(obj.Submeshes) > 0 {
+		obj.Submeshes = submeshes
+	}
+
+	stats.ACMRAfter = ACMR(obj.Indices, cacheSize)
+	stats.VerticesAfter = len(obj.Vertices) / 3
+	return stats
+}
+
+// ACMR simulates a FIFO vertex cache of the given size over a triangle list
+// and returns the average number of misses per triangle.
+func ACMR(indices []uint32, cacheSize int) float64 {
+	if len(indices) < 3 {
+		return 0
+	}
+
+	var vertexCount uint32
+	for _, index := range indices {
+		if index >= vertexCount {
+			vertexCount = index + 1
+		}
+	}
+
+	// A vertex is in the cache if it was added within the last cacheSize
+	// misses; timestamps avoid shifting a real queue.
+	added := make([]int, vertexCount)
+	for i := range added {
+		added[i] = -cacheSize - 1
+	}
+	misses := 0
+	for _, index := range indices {
+		if misses-added[index] <= cacheSize {
+			continue
+		}
+		added[index] = misses
+		misses++
+	}
+	return float64(misses) / float64(len(indices)/3)
+}
+
+// tipsifier orders the triangles of one submesh at a time, reusing its
+// buffers. Vertices are renumbered locally so that the buffers only need to
+// be as large as the submesh.
+type tipsifier struct {
+	cacheSize int
+	local     []int32 // local number of each mesh vertex, or -1
+
+	vertices  []uint32 // mesh vertex of each local vertex
+	live      []int    // triangles not yet emitted that use each local vertex
+	stamps    []int    // time each local vertex last entered the cache
+	adjacency []int    // triangles using each local vertex, see offsets
+	offsets   []int
+	emitted   []bool
+	deadEnds  []int32
+	output    []uint32
+}
+
+func newTipsifier(vertexCount, cacheSize int) *tipsifier {
+	t := &tipsifier{cacheSize: cacheSize, local: make([]int32, vertexCount)}
+	for i := range t.local {
+		t.local[i] = -1
+	}
+	return t
+}
+
+// order returns the triangles of indices in Tipsify order. The result is
+// only valid until the next call.
+func (t *tipsifier) order(indices []uint32) []uint32 {
+	triangleCount := len(indices) / 3
+
+	t.vertices = t.vertices[:0]
+	corners := make([]int32, len(indices))
+	for i, index := range indices {
+		if t.local[index] < 0 {
+			t.local[index] = int32(len(t.vertices))
+			t.vertices = append(t.vertices, index)
+		}
+		corners[i] = t.local[index]
+	}
+	vertexCount := len(t.vertices)
+
+	t.live = resizeInts(t.live, vertexCount)
+	t.stamps = resizeInts(t.stamps, vertexCount)
+	t.offsets = resizeInts(t.offsets, vertexCount+1)
+	for _, corner := range corners {
+		t.live[corner]++
+	}
+	for v := 0; v < vertexCount; v++ {
+		t.offsets[v+1] = t.offsets[v] + t.live[v]
+	}
+
+	t.adjacency = resizeInts(t.adjacency, len(corners))
+	fill := append([]int(nil), t.offsets[:vertexCount]...)
+	for i, corner := range corners {
+		t.adjacency[fill[corner]] = i / 3
+		fill[corner]++
+	}
+
+	if cap(t.emitted) < triangleCount {
+		t.emitted = make([]bool, triangleCount)
+	}
+	t.emitted = t.emitted[:triangleCount]
+	for i := range t.emitted {
+		t.emitted[i] = false
+	}
+
+	t.output = t.output[:0]
+	t.deadEnds = t.deadEnds[:0]
+	var candidates []int32
+
+	fanning := int32(0)
+	if vertexCount == 0 {
+		fanning = -1
+	}
+	time := t.cacheSize + 1
+	cursor := int32(0)
+
+	for fanning >= 0 {
+		candidates = candidates[:0]
+
+		for _, triangle := range t.adjacency[t.offsets[fanning]:t.offsets[fanning+1]] {
+			if t.emitted[triangle] {
+				continue
+			}
+			t.emitted[triangle] = true
+
+			for _, v := range corners[triangle*3 : triangle*3+3] {
+				t.output = append(t.output, t.vertices[v])
+				t.deadEnds = append(t.deadEnds, v)
+				candidates = append(candidates, v)
+				t.live[v]--
+				if time-t.stamps[v] > t.cacheSize {
+					t.stamps[v] = time
+					time++
+				}
+			}
+		}
+
+		fanning = t.nextVertex(candidates, time, &cursor)
+	}
+
+	for _, v := range t.vertices {
+		t.local[v] = -1
+	}
+	return t.output
+}
+
+// nextVertex picks the candidate still in the cache after its remaining
+// triangles are emitted that entered it earliest, or else a vertex from the
+// dead-end stack or the next vertex with triangles left.
+func (t *tipsifier) nextVertex(candidates []int32, time int, cursor *int32) int32 {
+	next, best := int32(-1), -1
+	for _, v := range candidates {
+		if t.live[v] == 0 {
+			continue
+		}
+		priority := 0
+		if age := time - t.stamps[v]; age+2*t.live[v] <= t.cacheSize {
+			priority = age
+		}
+		if priority > best {
+			next, best = v, priority
+		}
+	}
+	if next >= 0 {
+		return next
+	}
+
+	for len(t.deadEnds) > 0 {
+		v := t.deadEnds[len(t.deadEnds)-1]
+		t.deadEnds = t.deadEnds[:len(t.deadEnds)-1]
+		if t.live[v] > 0 {
+			return v
+		}
+	}
+
+	for ; int(*cursor) < len(t.vertices); *cursor++ {
+		if t.live[*cursor] > 0 {
+			return *cursor
+		}
+	}
+	return -1
+}
+
+func resizeInts(s []int, n int) []int {
+	if cap(s) < n {
+		return make([]int, n)
+	}
+	s = s[:n]
+	for i := range s {
+		s[i] = 0
+	}
+	return s
+}
+
+// reorderVertices renumbers the vertices of obj in the order the index
+// buffer first uses them and permutes every attribute array to match,
+// dropping unused vertices. The bounds are recomputed for what is left.
+func reorderVertices(obj *common.ObjectPrimitive) {
+	vertexCount := len(obj.Vertices) / 3
+	remap := make([]int32, vertexCount)
+	for i := range remap {
+		remap[i] = -1
+	}
+
+	var order []uint32
+	for i, index := range obj.Indices {
+		if remap[index] < 0 {
+			remap[index] = int32(len(order))
+			order = append(order, index)
+		}
+		obj.Indices[i] = uint32(remap[index])
+	}
+
+	permute := func(values []float32, size int) []float32 {
+		if len(values) < vertexCount*size {
+			return values
+		}
+		permuted := make([]float32, len(order)*size)
+		for i, v := range order {
+			copy(permuted[i*size:i*size+size], values[int(v)*size:])
+		}
+		return permuted
+	}
+	obj.Vertices = permute(obj.Vertices, 3)
+	obj.UVs = permute(obj.UVs, 2)
+	obj.Normals = permute(obj.Normals, 3)
+	obj.Tangents = permute(obj.Tangents, 4)
+	obj.UpdateBounds()
+}
+
+// weldVertices returns, for every vertex of obj, the index of the first
+// vertex whose attributes are all within tolerance of its own. Positions
+// are bucketed in a grid of tolerance-sized cells so only vertices in
+// neighbouring cells are compared.
+func weldVertices(obj *common.ObjectPrimitive, tolerance float32) []uint32 {
+	vertexCount := len(obj.Vertices) / 3
+	remap := make([]uint32, vertexCount)
+
+	cellSize := float64(tolerance)
+	if cellSize <= 0 {
+		cellSize = 1e-6
+	}
+	cell := func(v int) [3]int64 {
+		var key [3]int64
+		for axis := 0; axis < 3; axis++ {
+			key[axis] = int64(math.Floor(float64(obj.Vertices[v*3+axis]) / cellSize))
+		}
+		return key
+	}
+
+	near := func(values []float32, size, a, b int) bool {
+		if len(values) < vertexCount*size {
+			return true
+		}
+		for k := 0; k < size; k++ {
+			if math.Abs(float64(values[a*size+k]-values[b*size+k])) > float64(tolerance) {
+				return false
+			}
+		}
+		return true
+	}
+
+	grid := make(map[[3]int64][]uint32)
+	for v := 0; v < vertexCount; v++ {
+		key := cell(v)
+		remap[v] = uint32(v)
+
+	search:
+		for dx := int64(-1); dx <= 1; dx++ {
+			for dy := int64(-1); dy <= 1; dy++ {
+				for dz := int64(-1); dz <= 1; dz++ {
+					for _, other := range grid[[3]int64{key[0] + dx, key[1] + dy, key[2] + dz}] {
+						o := int(other)
+						if near(obj.Vertices, 3, v, o) && near(obj.UVs, 2, v, o) && near(obj.Normals, 3, v, o) &&
+							near(obj.Tangents, 4, v, o) {
+							remap[v] = other
+							break search
+						}
+					}
+				}
+			}
+		}
+
+		if remap[v] == uint32(v) {
+			grid[key] = append(grid[key], uint32(v))
+		}
+	}
+	return remap
+}
+
+// removeDegenerateTriangles drops triangles with repeated corners from every
+// submesh and returns the submeshes with their adjusted ranges.
+func removeDegenerateTriangles(obj *common.ObjectPrimitive, submeshes []common.Submesh) []common.Submesh {
+	indices := make([]uint32, 0, len(obj.Indices))
+	adjusted := make([]common.Submesh, len(submeshes))
+
+	for s, submesh := range submeshes {
+		adjusted[s] = submesh
+		adjusted[s].IndexOffset = len(indices)
+
+		end := submesh.IndexOffset + submesh.IndexCount
+		for i := submesh.IndexOffset; i+2 < end; i += 3 {
+			a, b, c := obj.Indices[i], obj.Indices[i+1], obj.Indices[i+2]
+			if a != b && b != c && c != a {
+				indices = append(indices, a, b, c)
+			}
+		}
+		adjusted[s].IndexCount = len(indices) - adjusted[s].IndexOffset
+	}
+
+	obj.Indices = indices
+	return adjusted
+}
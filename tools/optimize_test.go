@@ -0,0 +1,169 @@
+package tools
+
+import (
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// unwelded returns a copy of obj in which every triangle corner has a vertex
+// of its own, with the attributes of the vertex it was copied from.
+func unwelded(obj *common.ObjectPrimitive) *common.ObjectPrimitive {
+	copied := &common.ObjectPrimitive{Submeshes: obj.Submeshes}
+	for i, index := range obj.Indices {
+		copied.Indices = append(copied.Indices, uint32(i))
+		copied.Vertices = append(copied.Vertices, obj.Vertices[index*3:index*3+3]...)
+		copied.Normals = append(copied.Normals, obj.Normals[index*3:index*3+3]...)
+	}
+	return copied
+}
+
+// triangleSet returns the triangles of each submesh by corner position, each
+// rotated to start at its smallest corner and the lot sorted, so that meshes
+// can be compared regardless of triangle and vertex order.
+func triangleSet(obj *common.ObjectPrimitive) [][][9]float32 {
+	submeshes := obj.Submeshes
+	if len(submeshes) == 0 {
+		submeshes = []common.Submesh{{IndexCount: len(obj.Indices)}}
+	}
+
+	var sets [][][9]float32
+	for _, submesh := range submeshes {
+		var set [][9]float32
+		for t := submesh.IndexOffset; t < submesh.IndexOffset+submesh.IndexCount; t += 3 {
+			var corners [3][3]float32
+			for k := range corners {
+				copy(corners[k][:], obj.Vertices[obj.Indices[t+k]*3:])
+			}
+			first := 0
+			for k := 1; k < 3; k++ {
+				if less3(corners[k], corners[first]) {
+					first = k
+				}
+			}
+			var triangle [9]float32
+			for k := 0; k < 3; k++ {
+				copy(triangle[k*3:], corners[(first+k)%3][:])
+			}
+			set = append(set, triangle)
+		}
+		sort.Slice(set, func(i, j int) bool {
+			for k := range set[i] {
+				if set[i][k] != set[j][k] {
+					return set[i][k] < set[j][k]
+				}
+			}
+			return false
+		})
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+func less3(a, b [3]float32) bool {
+	for k := range a {
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+	return false
+}
+
+// shuffledSphere returns testSphere(n) split into two hemispheres, each a
+// submesh with its triangles in random order.
+func shuffledSphere(n int) *common.ObjectPrimitive {
+	obj := testSphere(n)
+	half := len(obj.Indices) / 6 * 3
+	obj.Submeshes = []common.Submesh{
+		{Name: "first", IndexOffset: 0, IndexCount: half},
+		{Name: "second", IndexOffset: half, IndexCount: len(obj.Indices) - half},
+	}
+
+	random := rand.New(rand.NewSource(1))
+	for _, submesh := range obj.Submeshes {
+		indices := obj.Indices[submesh.IndexOffset : submesh.IndexOffset+submesh.IndexCount]
+		random.Shuffle(len(indices)/3, func(i, j int) {
+			for k := 0; k < 3; k++ {
+				indices[i*3+k], indices[j*3+k] = indices[j*3+k], indices[i*3+k]
+			}
+		})
+	}
+	return obj
+}
+
+func TestOptimizeMesh(t *testing.T) {
+	tests := []struct {
+		name     string
+		mesh     *common.ObjectPrimitive
+		options  OptimizeOptions
+		vertices int
+		maxACMR  float64
+	}{
+		{"reorder", shuffledSphere(12), OptimizeOptions{}, len(testSphere(12).Vertices) / 3, 0.8},
+		{"weld", unwelded(shuffledSphere(12)), OptimizeOptions{Weld: true, WeldTolerance: 1e-5}, len(testSphere(12).Vertices) / 3, 0.8},
+		{"small cache", shuffledSphere(12), OptimizeOptions{CacheSize: 8}, len(testSphere(12).Vertices) / 3, 1.1},
+	}
+
+	for _, test := range tests {
+		want := triangleSet(test.mesh)
+		stats := OptimizeMesh(test.mesh, test.options)
+
+		if !reflect.DeepEqual(triangleSet(test.mesh), want) {
+			t.Errorf("%s: triangles changed or moved between submeshes", test.name)
+		}
+		if stats.VerticesAfter != test.vertices || len(test.mesh.Vertices)/3 != test.vertices {
+			t.Errorf("%s: %d vertices left, want %d", test.name, stats.VerticesAfter, test.vertices)
+		}
+		if stats.ACMRAfter >= stats.ACMRBefore || stats.ACMRAfter > test.maxACMR {
+			t.Errorf("%s: ACMR went from %.3f to %.3f", test.name, stats.ACMRBefore, stats.ACMRAfter)
+		}
+
+		// Vertices are numbered in the order the triangles first use them.
+		next := uint32(0)
+		for _, index := range test.mesh.Indices {
+			if index > next {
+				t.Errorf("%s: vertex %d is used before vertex %d", test.name, index, next)
+				break
+			}
+			if index == next {
+				next++
+			}
+		}
+	}
+}
+
+func TestACMR(t *testing.T) {
+	tests := []struct {
+		name    string
+		indices []uint32
+		cache   int
+		want    float64
+	}{
+		{"one triangle", []uint32{0, 1, 2}, 16, 3},
+		{"strip", []uint32{0, 1, 2, 2, 1, 3, 2, 3, 4, 4, 3, 5}, 16, 1.5},
+		{"evicted", []uint32{0, 1, 2, 3, 4, 5, 0, 1, 2}, 4, 3},
+		{"kept", []uint32{0, 1, 2, 3, 4, 5, 0, 1, 2}, 6, 2},
+	}
+	for _, test := range tests {
+		if got := ACMR(test.indices, test.cache); got != test.want {
+			t.Errorf("%s: got %g, want %g", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOptimizeMeshWeldsNearVertices(t *testing.T) {
+	obj := &common.ObjectPrimitive{
+		Vertices: []float32{0, 0, 0, 1, 0, 0, 1, 1, 0, 0, 1, 0, 1, 1.000001, 0},
+		Indices:  []uint32{0, 1, 2, 0, 2, 3, 2, 4, 1},
+	}
+	stats := OptimizeMesh(obj, OptimizeOptions{Weld: true, WeldTolerance: 1e-4})
+
+	if stats.VerticesAfter != 4 {
+		t.Errorf("got %d vertices, want 4", stats.VerticesAfter)
+	}
+	if len(obj.Indices) != 6 {
+		t.Errorf("got %d triangles, want the collapsed one removed", len(obj.Indices)/3)
+	}
+}
@@ -0,0 +1,49 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolvePath locates an asset that is referenced by path from inside the
+// file referrer, such as an MTL library named by an OBJ file or a texture
+// named by an MTL file. Relative paths are tried against the referrer's
+// directory, then against each of roots in order (both as written and by
+// base name), and finally against the working directory. If the asset cannot be
+// found, the path relative to the referrer is returned so that any error
+// reported when opening it points at the expected location.
+func ResolvePath(referrer, path string, roots []string) string {
+	if path == "" {
+		return ""
+	}
+
+	// Exporters on Windows write backslash separators.
+	path = filepath.FromSlash(strings.ReplaceAll(path, "\\", "/"))
+
+	if filepath.IsAbs(path) {
+		if fileExists(path) {
+			return path
+		}
+		path = filepath.Base(path)
+	}
+
+	local := filepath.Join(filepath.Dir(referrer), path)
+	candidates := []string{local}
+	for _, root := range roots {
+		candidates = append(candidates, filepath.Join(root, path), filepath.Join(root, filepath.Base(path)))
+	}
+	candidates = append(candidates, path)
+
+	for _, candidate := range candidates {
+		if fileExists(candidate) {
+			return candidate
+		}
+	}
+	return local
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePath(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"models/tex/brick.png",
+		"shared/abs.png",
+		"assets/textures/wood.png",
+		"assets/stone.png",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	referrer := filepath.Join(dir, "models", "scene.mtl")
+	roots := []string{filepath.Join(dir, "missing"), filepath.Join(dir, "assets")}
+	at := func(name string) string { return filepath.Join(dir, filepath.FromSlash(name)) }
+
+	tests := []struct {
+		name  string
+		path  string
+		roots []string
+		want  string
+	}{
+		{"empty", "", roots, ""},
+		{"relative to referrer", "tex/brick.png", roots, at("models/tex/brick.png")},
+		{"absolute", at("shared/abs.png"), roots, at("shared/abs.png")},
+		{"search root", "textures/wood.png", roots, at("assets/textures/wood.png")},
+		{"missing absolute path", at("gone/stone.png"), roots, at("assets/stone.png")},
+		{"base name of a relative path", "exported/stone.png", roots, at("assets/stone.png")},
+		{"windows separators", `tex\brick.png`, roots, at("models/tex/brick.png")},
+		{"no roots", "textures/wood.png", nil, at("models/textures/wood.png")},
+		{"missing", "nowhere.png", roots, at("models/nowhere.png")},
+	}
+
+	for _, test := range tests {
+		if got := ResolvePath(referrer, test.path, test.roots); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOBJSearchRoots(t *testing.T) {
+	path := writeTestFile(t, "scene.obj", "mtllib scene.mtl\nv 0 0 0\nv 1 0 0\nv 1 1 0\nf 1 2 3\n")
+	root := t.TempDir()
+	materialLib := filepath.Join(root, "scene.mtl")
+	if err := os.WriteFile(materialLib, []byte("newmtl a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := CreateNewOBJWithOptions(path, OBJOptions{SearchRoots: []string{root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.MaterialLib != materialLib {
+		t.Errorf("with roots: got %q, want %q", obj.MaterialLib, materialLib)
+	}
+
+	obj, err = CreateNewOBJ(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(filepath.Dir(path), "scene.mtl"); obj.MaterialLib != want {
+		t.Errorf("without roots: got %q, want %q", obj.MaterialLib, want)
+	}
+}
@@ -0,0 +1,294 @@
+package tools
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidPLY = errors.New("invalid PLY")
+
+type plyProperty struct {
+	name      string
+	valueType string
+	countType string // set for list properties
+}
+
+type plyElement struct {
+	name       string
+	count      int
+	properties []plyProperty
+}
+
+// plyReader reads property values from either the ASCII or a binary body.
+type plyReader struct {
+	ascii  bool
+	order  binary.ByteOrder
+	reader *bufio.Reader
+	tokens []string
+}
+
+// plyPreallocate caps the capacity reserved for an element or list from the
+// count in the file, which a damaged or hostile file can make far larger than
+// the data that follows. Slices grow past it as values are actually read.
+const plyPreallocate = 1 << 16
+
+var plyTypeSizes = map[string]int{
+	"char": 1, "int8": 1, "uchar": 1, "uint8": 1,
+	"short": 2, "int16": 2, "ushort": 2, "uint16": 2,
+	"int": 4, "int32": 4, "uint": 4, "uint32": 4,
+	"float": 4, "float32": 4,
+	"double": 8, "float64": 8,
+}
+
+// CreateNewPLY loads an ASCII or binary (either endianness) PLY file. The
+// vertex element supplies positions and, when present, normals (nx, ny, nz)
+// and texture coordinates (s/t, u/v or texture_u/texture_v); the face
+// element supplies polygons, which are triangulated. Identical vertices are
+// merged and smooth normals generated if the file has none.
+func CreateNewPLY(modelFPath string) (*common.ObjectPrimitive, error) {
+	file, err := os.Open(modelFPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	elements, ply, err := readPLYHeader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", modelFPath, err)
+	}
+
+	var vertices []Vertex
+	var faces [][]int
+	hasNormals := false
+
+	for _, element := range elements {
+		if len(element.properties) == 0 {
+			continue // nothing to read, however large the count
+		}
+
+		switch element.name {
+		case "vertex":
+			vertices = make([]Vertex, 0, min(element.count, plyPreallocate))
+			for _, property := range element.properties {
+				if property.name == "nx" {
+					hasNormals = true
+				}
+			}
+		case "face":
+			faces = make([][]int, 0, min(element.count, plyPreallocate))
+		}
+
+		for i := 0; i < element.count; i++ {
+			if element.name == "vertex" {
+				vertices = append(vertices, Vertex{})
+			}
+			for _, property := range element.properties {
+				if property.countType != "" {
+					count, err := ply.read(property.countType)
+					if err != nil {
+						return nil, fmt.Errorf("%s: element %s: %w", modelFPath, element.name, err)
+					}
+					if count < 0 {
+						return nil, fmt.Errorf("%s: negative list length: %w", modelFPath, ErrInvalidPLY)
+					}
+
+					list := make([]int, 0, min(int(count), plyPreallocate))
+					for k := 0; k < int(count); k++ {
+						value, err := ply.read(property.valueType)
+						if err != nil {
+							return nil, fmt.Errorf("%s: element %s: %w", modelFPath, element.name, err)
+						}
+						list = append(list, int(value))
+					}
+
+					if element.name == "face" && (property.name == "vertex_indices" || property.name == "vertex_index") {
+						faces = append(faces, list)
+					}
+					continue
+				}
+
+				value, err := ply.read(property.valueType)
+				if err != nil {
+					return nil, fmt.Errorf("%s: element %s: %w", modelFPath, element.name, err)
+				}
+				if element.name == "vertex" {
+					setPLYVertexProperty(&vertices[len(vertices)-1], property.name, float32(value))
+				}
+			}
+		}
+	}
+
+	builder := newMeshBuilder()
+	remap := make([]uint32, len(vertices))
+	for i, vertex := range vertices {
+		remap[i] = builder.add(vertex)
+	}
+
+	for _, face := range faces {
+		polygon := make([][3]float32, len(face))
+		for k, index := range face {
+			if index < 0 || index >= len(vertices) {
+				return nil, fmt.Errorf("%s: face index %d: %w", modelFPath, index, ErrIndexOutOfRange)
+			}
+			polygon[k] = vertices[index].Position
+		}
+
+		for _, triangle := range Triangulate(polygon) {
+			builder.addTriangle(remap[face[triangle[0]]], remap[face[triangle[1]]], remap[face[triangle[2]]])
+		}
+	}
+
+	if !hasNormals {
+		generateSmoothNormals(builder.obj)
+	}
+	builder.obj.UpdateBounds()
+	return builder.obj, nil
+}
+
+func setPLYVertexProperty(vertex *Vertex, name string, value float32) {
+	switch name {
+	case "x":
+		vertex.Position[0] = value
+	case "y":
+		vertex.Position[1] = value
+	case "z":
+		vertex.Position[2] = value
+	case "nx":
+		vertex.Normal[0] = value
+	case "ny":
+		vertex.Normal[1] = value
+	case "nz":
+		vertex.Normal[2] = value
+	case "s", "u", "texture_u", "texture_s":
+		vertex.UV[0] = value
+	case "t", "v", "texture_v", "texture_t":
+		vertex.UV[1] = value
+	}
+}
+
+func readPLYHeader(reader *bufio.Reader) ([]*plyElement, *plyReader, error) {
+	var elements []*plyElement
+	ply := &plyReader{reader: reader}
+
+	line, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "ply" {
+		return nil, nil, fmt.Errorf("missing ply magic: %w", ErrInvalidPLY)
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, nil, fmt.Errorf("unterminated header: %w", ErrInvalidPLY)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "format":
+			if len(fields) < 2 {
+				return nil, nil, fmt.Errorf("bad format line: %w", ErrInvalidPLY)
+			}
+			switch fields[1] {
+			case "ascii":
+				ply.ascii = true
+			case "binary_little_endian":
+				ply.order = binary.LittleEndian
+			case "binary_big_endian":
+				ply.order = binary.BigEndian
+			default:
+				return nil, nil, fmt.Errorf("unknown format %q: %w", fields[1], ErrInvalidPLY)
+			}
+		case "element":
+			if len(fields) < 3 {
+				return nil, nil, fmt.Errorf("bad element line: %w", ErrInvalidPLY)
+			}
+			count, err := strconv.Atoi(fields[2])
+			if err != nil || count < 0 {
+				return nil, nil, fmt.Errorf("bad element count %q: %w", fields[2], ErrInvalidPLY)
+			}
+			elements = append(elements, &plyElement{name: fields[1], count: count})
+		case "property":
+			if len(elements) == 0 {
+				return nil, nil, fmt.Errorf("property before element: %w", ErrInvalidPLY)
+			}
+			element := elements[len(elements)-1]
+
+			var property plyProperty
+			if len(fields) == 5 && fields[1] == "list" {
+				property = plyProperty{countType: fields[2], valueType: fields[3], name: fields[4]}
+			} else if len(fields) == 3 {
+				property = plyProperty{valueType: fields[1], name: fields[2]}
+			} else {
+				return nil, nil, fmt.Errorf("bad property line: %w", ErrInvalidPLY)
+			}
+
+			for _, valueType := range []string{property.valueType, property.countType} {
+				if _, ok := plyTypeSizes[valueType]; valueType != "" && !ok {
+					return nil, nil, fmt.Errorf("unknown property type %q: %w", valueType, ErrInvalidPLY)
+				}
+			}
+			element.properties = append(element.properties, property)
+		case "end_header":
+			if !ply.ascii && ply.order == nil {
+				return nil, nil, fmt.Errorf("missing format line: %w", ErrInvalidPLY)
+			}
+			return elements, ply, nil
+		}
+	}
+}
+
+// read returns the next value of the given PLY type.
+func (p *plyReader) read(valueType string) (float64, error) {
+	if p.ascii {
+		for len(p.tokens) == 0 {
+			line, err := p.reader.ReadString('\n')
+			p.tokens = strings.Fields(line)
+			if err != nil && len(p.tokens) == 0 {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+		}
+		token := p.tokens[0]
+		p.tokens = p.tokens[1:]
+		return strconv.ParseFloat(token, 64)
+	}
+
+	var buffer [8]byte
+	size := plyTypeSizes[valueType]
+	if _, err := io.ReadFull(p.reader, buffer[:size]); err != nil {
+		return 0, err
+	}
+
+	switch valueType {
+	case "char", "int8":
+		return float64(int8(buffer[0])), nil
+	case "uchar", "uint8":
+		return float64(buffer[0]), nil
+	case "short", "int16":
+		return float64(int16(p.order.Uint16(buffer[:]))), nil
+	case "ushort", "uint16":
+		return float64(p.order.Uint16(buffer[:])), nil
+	case "int", "int32":
+		return float64(int32(p.order.Uint32(buffer[:]))), nil
+	case "uint", "uint32":
+		return float64(p.order.Uint32(buffer[:])), nil
+	case "float", "float32":
+		return float64(math.Float32frombits(p.order.Uint32(buffer[:]))), nil
+	case "double", "float64":
+		return math.Float64frombits(p.order.Uint64(buffer[:])), nil
+	}
+	return 0, fmt.Errorf("unknown property type %q: %w", valueType, ErrInvalidPLY)
+}
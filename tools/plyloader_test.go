@@ -0,0 +1,61 @@
+package tools
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestPLYQuad(t *testing.T) {
+	ascii := "ply\nformat ascii 1.0\nelement vertex 4\nproperty float x\nproperty float y\nproperty float z\n" +
+		"element face 1\nproperty list uchar int vertex_indices\nend_header\n" +
+		"0 0 0\n1 0 0\n1 1 0\n0 1 0\n4 0 1 2 3\n"
+
+	header := "ply\nformat binary_little_endian 1.0\nelement vertex 4\nproperty float x\nproperty float y\nproperty float z\n" +
+		"element face 1\nproperty list uchar uint vertex_indices\nend_header\n"
+	body := []byte(header)
+	for _, value := range []float32{0, 0, 0, 1, 0, 0, 1, 1, 0, 0, 1, 0} {
+		body = binary.LittleEndian.AppendUint32(body, math.Float32bits(value))
+	}
+	body = append(body, 4)
+	for _, index := range []uint32{0, 1, 2, 3} {
+		body = binary.LittleEndian.AppendUint32(body, index)
+	}
+
+	for name, content := range map[string]string{"ascii": ascii, "binary": string(body)} {
+		obj, err := CreateNewPLY(writeTestFile(t, "quad.ply", content))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(obj.Vertices) != 12 || len(obj.Indices) != 6 {
+			t.Errorf("%s: got %d vertices and %d indices, want 4 and 6", name, len(obj.Vertices)/3, len(obj.Indices))
+		}
+	}
+}
+
+func TestPLYHostileCounts(t *testing.T) {
+	listHeader := "ply\nformat binary_little_endian 1.0\nelement vertex 3\nproperty float x\nproperty float y\nproperty float z\n" +
+		"element face 1\nproperty list uint uint vertex_indices\nend_header\n"
+	list := []byte(listHeader)
+	list = append(list, make([]byte, 36)...)
+	list = binary.LittleEndian.AppendUint32(list, 4000000000)
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"vertex count", "ply\nformat ascii 1.0\nelement vertex 4000000000\nproperty float x\nproperty float y\nproperty float z\nend_header\n0 0 0\n"},
+		{"face count", "ply\nformat binary_little_endian 1.0\nelement face 4000000000\nproperty list uchar int vertex_indices\nend_header\n\x03"},
+		{"list length", string(list)},
+	}
+
+	for _, test := range tests {
+		_, err := CreateNewPLY(writeTestFile(t, "hostile.ply", test.content))
+		if !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			t.Errorf("%s: got %v, want the body to run out", test.name, err)
+		}
+	}
+}
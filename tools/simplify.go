@@ -0,0 +1,460 @@
+package tools
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"math"
+)
+
+// ErrNotSimplified is returned by GenerateLODs when a level keeps every
+// triangle of the one before it, as happens when the whole mesh is locked.
+var ErrNotSimplified = errors.New("mesh could not be simplified")
+
+// SimplifyMesh returns a copy of obj reduced to roughly ratio of its
+// triangles, with unused vertices dropped. See SimplifyIndices.
+func SimplifyMesh(obj *common.ObjectPrimitive, ratio float32) *common.ObjectPrimitive {
+	target := int(float32(len(obj.Indices)/3) * ratio)
+	indices, submeshes := SimplifyIndices(obj, target)
+	return compactMesh(obj, indices, submeshes)
+}
+
+// GenerateLODs returns a chain of simplified copies of obj, one for each
+// ratio of the original triangle count. Each level is simplified from the
+// one before it, so ratios should be decreasing. If a level asks for fewer
+// triangles than the one before it but none could be removed, the levels
+// made so far are returned with an error wrapping ErrNotSimplified.
+func GenerateLODs(obj *common.ObjectPrimitive, ratios []float32) ([]*common.ObjectPrimitive, error) {
+	triangles := len(obj.Indices) / 3
+	levels := make([]*common.ObjectPrimitive, 0, len(ratios))
+
+	previous := obj
+	for i, ratio := range ratios {
+		target := int(float32(triangles) * ratio)
+		indices, submeshes := SimplifyIndices(previous, target)
+		if before := len(previous.Indices) / 3; target < before && len(indices)/3 >= before {
+			return levels, fmt.Errorf("LOD %d kept all %d triangles: %w", i, before, ErrNotSimplified)
+		}
+		level := compactMesh(previous, indices, submeshes)
+		levels = append(levels, level)
+		previous = level
+	}
+	return levels, nil
+}
+
+// SimplifyIndices collapses edges of obj, cheapest first by the quadric error
+// metric (Garland and Heckbert, "Surface Simplification Using Quadric Error
+// Metrics"), until at most targetTriangles remain or no collapse is left
+// that keeps the surface intact. Edges are collapsed onto one of their
+// vertices, so the result indexes the vertices of obj unchanged and can
+// share its vertex buffer.
+//
+// Vertices that share a position are simplified as one, so hard edges and
+// flat-shaded meshes, where every triangle has vertices of its own, collapse
+// like smooth ones; a corner that moves takes the vertex at its new position
+// whose normal is closest to its old one. Positions on open borders, on UV
+// seams (where the vertices sharing them have different texture coordinates)
+// and positions used by more than one submesh never move, which keeps
+// outlines, texture layout and material boundaries in place. Triangles stay
+// in their submesh; the returned submeshes describe the ranges of the new
+// index buffer.
+func SimplifyIndices(obj *common.ObjectPrimitive, targetTriangles int) ([]uint32, []common.Submesh) {
+	obj.SplitInterleaved()
+	submeshes := obj.Submeshes
+	if len(submeshes) == 0 {
+		submeshes = []common.Submesh{{IndexCount: len(obj.Indices)}}
+	}
+
+	s := newSimplifier(obj, submeshes)
+	s.run(targetTriangles)
+
+	indices := make([]uint32, 0, s.liveTriangles*3)
+	simplified := make([]common.Submesh, len(submeshes))
+	for i, submesh := range submeshes {
+		simplified[i] = submesh
+		simplified[i].IndexOffset = len(indices)
+		for t := submesh.IndexOffset / 3; t < (submesh.IndexOffset+submesh.IndexCount)/3; t++ {
+			if !s.removed[t] {
+				indices = append(indices, s.vertices[t*3:t*3+3]...)
+			}
+		}
+		simplified[i].IndexCount = len(indices) - simplified[i].IndexOffset
+	}
+	return indices, simplified
+}
+
+// compactMesh builds a standalone mesh from obj with the given triangles,
+// keeping only the vertices they use.
+func compactMesh(obj *common.ObjectPrimitive, indices []uint32, submeshes []common.Submesh) *common.ObjectPrimitive {
+	mesh := *obj
+	mesh.Indices = indices
+	if len(obj.Submeshes) > 0 {
+		mesh.Submeshes = submeshes
+	}
+	reorderVertices(&mesh)
+	return &mesh
+}
+
+// quadric is a symmetric 4x4 matrix stored as its upper triangle: aa, ab,
+// ac, ad, bb, bc, bd, cc, cd, dd for the plane ax + by + cz + d = 0.
+type quadric [10]float64
+
+func planeQuadric(normal [3]float64, d, weight float64) quadric {
+	a, b, c := normal[0], normal[1], normal[2]
+	return quadric{
+		a * a * weight, a * b * weight, a * c * weight, a * d * weight,
+		b * b * weight, b * c * weight, b * d * weight,
+		c * c * weight, c * d * weight,
+		d * d * weight,
+	}
+}
+
+func (q *quadric) add(other quadric) {
+	for i := range q {
+		q[i] += other[i]
+	}
+}
+
+// evaluate returns the summed squared distance of p from the planes of q.
+func (q *quadric) evaluate(p [3]float64) float64 {
+	x, y, z := p[0], p[1], p[2]
+	return q[0]*x*x + 2*q[1]*x*y + 2*q[2]*x*z + 2*q[3]*x +
+		q[4]*y*y + 2*q[5]*y*z + 2*q[6]*y +
+		q[7]*z*z + 2*q[8]*z +
+		q[9]
+}
+
+// collapse is a candidate move of vertex from onto vertex to.
+type collapse struct {
+	cost     float64
+	from, to uint32
+	versions [2]int
+}
+
+type collapseQueue []collapse
+
+func (q collapseQueue) Len() int            { return len(q) }
+func (q collapseQueue) Less(i, j int) bool  { return q[i].cost < q[j].cost }
+func (q collapseQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *collapseQueue) Push(x interface{}) { *q = append(*q, x.(collapse)) }
+func (q *collapseQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+type simplifier struct {
+	positions []float32
+	normals   []float32
+	indices   []uint32 // corners by representative vertex, see members
+	vertices  []uint32 // corners by vertex of the mesh
+	members   [][]uint32
+
+	removed       []bool
+	liveTriangles int
+
+	triangles [][]int32 // triangles around each vertex, possibly removed ones
+	quadrics  []quadric
+	locked    []bool
+	collapsed []bool
+	versions  []int
+
+	queue collapseQueue
+}
+
+func newSimplifier(obj *common.ObjectPrimitive, submeshes []common.Submesh) *simplifier {
+	vertexCount := len(obj.Vertices) / 3
+	triangleCount := len(obj.Indices) / 3
+
+	s := &simplifier{
+		positions:     obj.Vertices,
+		normals:       obj.Normals,
+		indices:       make([]uint32, triangleCount*3),
+		vertices:      append([]uint32(nil), obj.Indices[:triangleCount*3]...),
+		members:       make([][]uint32, vertexCount),
+		removed:       make([]bool, triangleCount),
+		liveTriangles: triangleCount,
+		triangles:     make([][]int32, vertexCount),
+		quadrics:      make([]quadric, vertexCount),
+		locked:        make([]bool, vertexCount),
+		collapsed:     make([]bool, vertexCount),
+		versions:      make([]int, vertexCount),
+	}
+
+	// Seams split a position into several vertices. The first of them
+	// represents the position and carries its topology, quadric and lock;
+	// members lists the vertices it stands for.
+	representative := make([]uint32, vertexCount)
+	byPosition := make(map[[3]float32]uint32, vertexCount)
+	for v := 0; v < vertexCount; v++ {
+		position := s.position3(uint32(v))
+		first, found := byPosition[position]
+		if !found {
+			first = uint32(v)
+			byPosition[position] = first
+		} else if !sameUV(obj.UVs, vertexCount, v, int(first)) {
+			s.locked[first] = true
+		}
+		representative[v] = first
+		s.members[first] = append(s.members[first], uint32(v))
+	}
+	for i, vertex := range s.vertices {
+		s.indices[i] = representative[vertex]
+	}
+
+	// Positions used by more than one submesh sit on a material boundary.
+	submeshOf := make([]int, vertexCount)
+	for i, submesh := range submeshes {
+		for _, index := range obj.Indices[submesh.IndexOffset : submesh.IndexOffset+submesh.IndexCount] {
+			index = representative[index]
+			if submeshOf[index] != 0 && submeshOf[index] != i+1 {
+				s.locked[index] = true
+			}
+			submeshOf[index] = i + 1
+		}
+	}
+
+	// Edges used by one triangle are borders, edges used by more than two
+	// are non-manifold; neither may move.
+	edgeUse := make(map[[2]uint32]int, triangleCount*3/2)
+	for t := 0; t < triangleCount; t++ {
+		corners := s.indices[t*3 : t*3+3]
+		if corners[0] == corners[1] || corners[1] == corners[2] || corners[2] == corners[0] {
+			s.removed[t] = true
+			s.liveTriangles--
+			continue
+		}
+
+		for k := 0; k < 3; k++ {
+			edgeUse[edgeKey(corners[k], corners[(k+1)%3])]++
+			s.triangles[corners[k]] = append(s.triangles[corners[k]], int32(t))
+		}
+
+		normal, area := s.triangleNormal(corners[0], corners[1], corners[2])
+		if area > 0 {
+			d := -dot64(normal, s.position(corners[0]))
+			plane := planeQuadric(normal, d, area)
+			for _, corner := range corners {
+				s.quadrics[corner].add(plane)
+			}
+		}
+	}
+	for edge, count := range edgeUse {
+		if count != 2 {
+			s.locked[edge[0]], s.locked[edge[1]] = true, true
+		}
+	}
+
+	// Each interior edge runs one way in each of its triangles, so pushing
+	// it from the ascending side queues it once, in a repeatable order.
+	for t := 0; t < triangleCount; t++ {
+		if s.removed[t] {
+			continue
+		}
+		corners := s.indices[t*3 : t*3+3]
+		for k := 0; k < 3; k++ {
+			if a, b := corners[k], corners[(k+1)%3]; a < b || edgeUse[edgeKey(a, b)] == 1 {
+				s.push(a, b)
+			}
+		}
+	}
+	return s
+}
+
+// sameUV reports whether vertices a and b have the same texture coordinates,
+// which they do when the mesh has none.
+func sameUV(uvs []float32, vertexCount, a, b int) bool {
+	if len(uvs) < vertexCount*2 {
+		return true
+	}
+	return uvs[a*2] == uvs[b*2] && uvs[a*2+1] == uvs[b*2+1]
+}
+
+// counterpart returns the vertex at the position represented by to whose
+// normal is closest to that of v.
+func (s *simplifier) counterpart(to, v uint32) uint32 {
+	members := s.members[to]
+	if len(members) == 1 || len(s.normals) < len(s.positions) {
+		return members[0]
+	}
+
+	best, bestDot := members[0], math.Inf(-1)
+	for _, member := range members {
+		dot := 0.0
+		for k := uint32(0); k < 3; k++ {
+			dot += float64(s.normals[v*3+k]) * float64(s.normals[member*3+k])
+		}
+		if dot > bestDot {
+			best, bestDot = member, dot
+		}
+	}
+	return best
+}
+
+func edgeKey(a, b uint32) [2]uint32 {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]uint32{a, b}
+}
+
+func (s *simplifier) position3(v uint32) [3]float32 {
+	return [3]float32{s.positions[v*3], s.positions[v*3+1], s.positions[v*3+2]}
+}
+
+func (s *simplifier) position(v uint32) [3]float64 {
+	return [3]float64{float64(s.positions[v*3]), float64(s.positions[v*3+1]), float64(s.positions[v*3+2])}
+}
+
+// triangleNormal returns the unit normal and the area of a triangle.
+func (s *simplifier) triangleNormal(a, b, c uint32) ([3]float64, float64) {
+	pa := s.position3(a)
+	normal := cross64(sub64(s.position3(b), pa), sub64(s.position3(c), pa))
+	length := math.Sqrt(dot64(normal, normal))
+	if length == 0 {
+		return normal, 0
+	}
+	return [3]float64{normal[0] / length, normal[1] / length, normal[2] / length}, length / 2
+}
+
+// push queues the cheaper allowed direction of collapsing the edge a-b.
+func (s *simplifier) push(a, b uint32) {
+	best := collapse{cost: math.Inf(1)}
+	for _, direction := range [2][2]uint32{{a, b}, {b, a}} {
+		from, to := direction[0], direction[1]
+		if s.locked[from] {
+			continue
+		}
+
+		q := s.quadrics[from]
+		q.add(s.quadrics[to])
+		if cost := q.evaluate(s.position(to)); cost < best.cost {
+			best = collapse{cost: cost, from: from, to: to, versions: [2]int{s.versions[from], s.versions[to]}}
+		}
+	}
+
+	if !math.IsInf(best.cost, 1) {
+		heap.Push(&s.queue, best)
+	}
+}
+
+func (s *simplifier) run(targetTriangles int) {
+	for s.liveTriangles > targetTriangles && s.queue.Len() > 0 {
+		next := heap.Pop(&s.queue).(collapse)
+		if s.collapsed[next.from] || s.collapsed[next.to] ||
+			s.versions[next.from] != next.versions[0] || s.versions[next.to] != next.versions[1] {
+			continue
+		}
+		if !s.canCollapse(next.from, next.to) {
+			continue
+		}
+		s.collapse(next.from, next.to)
+	}
+}
+
+// neighbours returns the vertices sharing a live triangle with v.
+func (s *simplifier) neighbours(v uint32, into []uint32) []uint32 {
+	into = into[:0]
+	for _, t := range s.triangles[v] {
+		if s.removed[t] {
+			continue
+		}
+		for _, corner := range s.indices[t*3 : t*3+3] {
+			if corner == v {
+				continue
+			}
+			seen := false
+			for _, n := range into {
+				if n == corner {
+					seen = true
+					break
+				}
+			}
+			if !seen {
+				into = append(into, corner)
+			}
+		}
+	}
+	return into
+}
+
+// canCollapse checks that moving from onto to keeps the mesh manifold and
+// flips no triangle.
+func (s *simplifier) canCollapse(from, to uint32) bool {
+	shared := 0
+	for _, t := range s.triangles[from] {
+		if s.removed[t] {
+			continue
+		}
+		corners := s.indices[t*3 : t*3+3]
+		if corners[0] == to || corners[1] == to || corners[2] == to {
+			shared++
+			continue
+		}
+
+		// The triangle keeps its orientation once from is replaced, turning
+		// by at most 60 degrees so that no sliver folds over its neighbours.
+		before, _ := s.triangleNormal(corners[0], corners[1], corners[2])
+		var moved [3]uint32
+		for k, corner := range corners {
+			moved[k] = corner
+			if corner == from {
+				moved[k] = to
+			}
+		}
+		after, area := s.triangleNormal(moved[0], moved[1], moved[2])
+		if area == 0 || dot64(before, after) < 0.5 {
+			return false
+		}
+	}
+	if shared == 0 {
+		return false
+	}
+
+	// The link condition: the vertices adjacent to both ends of the edge
+	// are exactly the third corners of the triangles on it.
+	fromNeighbours := s.neighbours(from, nil)
+	toNeighbours := s.neighbours(to, nil)
+	common := 0
+	for _, a := range fromNeighbours {
+		for _, b := range toNeighbours {
+			if a == b {
+				common++
+			}
+		}
+	}
+	return common == shared
+}
+
+func (s *simplifier) collapse(from, to uint32) {
+	for _, t := range s.triangles[from] {
+		if s.removed[t] {
+			continue
+		}
+		corners := s.indices[t*3 : t*3+3]
+		if corners[0] == to || corners[1] == to || corners[2] == to {
+			s.removed[t] = true
+			s.liveTriangles--
+			continue
+		}
+		for k := range corners {
+			if corners[k] == from {
+				corners[k] = to
+				s.vertices[int(t)*3+k] = s.counterpart(to, s.vertices[int(t)*3+k])
+			}
+		}
+		s.triangles[to] = append(s.triangles[to], t)
+	}
+
+	s.triangles[from] = nil
+	s.collapsed[from] = true
+	s.quadrics[to].add(s.quadrics[from])
+	s.versions[to]++
+
+	// Every edge of to now has a different cost.
+	for _, neighbour := range s.neighbours(to, nil) {
+		s.push(to, neighbour)
+	}
+}
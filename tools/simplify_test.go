@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"errors"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"math"
+	"testing"
+)
+
+// testSphere returns a closed, smooth-shaded sphere of radius 1 made from a
+// cube whose faces are split into n by n quads, each projected outward.
+func testSphere(n int) *common.ObjectPrimitive {
+	obj := &common.ObjectPrimitive{}
+	index := make(map[[3]float32]uint32)
+	vertex := func(p [3]float64) uint32 {
+		length := math.Sqrt(p[0]*p[0] + p[1]*p[1] + p[2]*p[2])
+		position := [3]float32{float32(p[0] / length), float32(p[1] / length), float32(p[2] / length)}
+		if i, ok := index[position]; ok {
+			return i
+		}
+		i := uint32(len(obj.Vertices) / 3)
+		index[position] = i
+		obj.Vertices = append(obj.Vertices, position[:]...)
+		obj.Normals = append(obj.Normals, position[:]...)
+		return i
+	}
+
+	// Each face is spanned by u and v from its corner, with u x v pointing out.
+	faces := [][3][3]float64{
+		{{1, -1, -1}, {0, 2, 0}, {0, 0, 2}},
+		{{-1, -1, -1}, {0, 0, 2}, {0, 2, 0}},
+		{{-1, 1, -1}, {0, 0, 2}, {2, 0, 0}},
+		{{-1, -1, -1}, {2, 0, 0}, {0, 0, 2}},
+		{{-1, -1, 1}, {2, 0, 0}, {0, 2, 0}},
+		{{-1, -1, -1}, {0, 2, 0}, {2, 0, 0}},
+	}
+	for _, face := range faces {
+		at := func(i, j int) uint32 {
+			var p [3]float64
+			for k := 0; k < 3; k++ {
+				p[k] = face[0][k] + face[1][k]*float64(i)/float64(n) + face[2][k]*float64(j)/float64(n)
+			}
+			return vertex(p)
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				a, b, c, d := at(i, j), at(i+1, j), at(i+1, j+1), at(i, j+1)
+				obj.Indices = append(obj.Indices, a, b, c, a, c, d)
+			}
+		}
+	}
+	obj.UpdateBounds()
+	return obj
+}
+
+// flatShaded returns a copy of obj in which every triangle has vertices of
+// its own with the triangle's normal.
+func flatShaded(obj *common.ObjectPrimitive) *common.ObjectPrimitive {
+	flat := &common.ObjectPrimitive{}
+	for t := 0; t+2 < len(obj.Indices); t += 3 {
+		var corners [3][3]float32
+		for k := range corners {
+			copy(corners[k][:], obj.Vertices[obj.Indices[t+k]*3:])
+		}
+		normal := cross64(sub64(corners[1], corners[0]), sub64(corners[2], corners[0]))
+		length := math.Sqrt(dot64(normal, normal))
+		for k := range corners {
+			flat.Indices = append(flat.Indices, uint32(len(flat.Vertices)/3))
+			flat.Vertices = append(flat.Vertices, corners[k][:]...)
+			flat.Normals = append(flat.Normals, float32(normal[0]/length), float32(normal[1]/length), float32(normal[2]/length))
+		}
+	}
+	flat.UpdateBounds()
+	return flat
+}
+
+func TestSimplifyIndices(t *testing.T) {
+	tests := []struct {
+		name string
+		mesh *common.ObjectPrimitive
+	}{
+		{"smooth", testSphere(8)},
+		{"flat", flatShaded(testSphere(8))},
+	}
+
+	for _, test := range tests {
+		before := len(test.mesh.Indices) / 3
+		target := before / 4
+		indices, submeshes := SimplifyIndices(test.mesh, target)
+
+		if after := len(indices) / 3; after > target {
+			t.Errorf("%s: %d of %d triangles left, want at most %d", test.name, after, before, target)
+		}
+		if len(submeshes) != 1 || submeshes[0].IndexCount != len(indices) {
+			t.Errorf("%s: submeshes %v do not cover the %d indices", test.name, submeshes, len(indices))
+		}
+
+		// The sphere is convex around the origin, so every triangle must
+		// still face away from it.
+		for i := 0; i+2 < len(indices); i += 3 {
+			var corners [3][3]float32
+			for k := range corners {
+				copy(corners[k][:], test.mesh.Vertices[indices[i+k]*3:])
+			}
+			normal := cross64(sub64(corners[1], corners[0]), sub64(corners[2], corners[0]))
+			center := [3]float64{
+				float64(corners[0][0] + corners[1][0] + corners[2][0]),
+				float64(corners[0][1] + corners[1][1] + corners[2][1]),
+				float64(corners[0][2] + corners[1][2] + corners[2][2]),
+			}
+			if dot64(normal, center) <= 0 {
+				t.Errorf("%s: triangle %d is flipped", test.name, i/3)
+				break
+			}
+		}
+	}
+}
+
+func TestGenerateLODs(t *testing.T) {
+	levels, err := GenerateLODs(flatShaded(testSphere(6)), []float32{0.5, 0.25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(levels) != 2 || len(levels[1].Indices) >= len(levels[0].Indices) {
+		t.Errorf("levels did not shrink: %d levels", len(levels))
+	}
+
+	// Every vertex of a lone triangle is on a border, so nothing can move.
+	triangle := &common.ObjectPrimitive{Vertices: []float32{0, 0, 0, 1, 0, 0, 0, 1, 0}, Indices: []uint32{0, 1, 2}}
+	if levels, err := GenerateLODs(triangle, []float32{0.5}); !errors.Is(err, ErrNotSimplified) || len(levels) != 0 {
+		t.Errorf("got %d levels and %v, want ErrNotSimplified", len(levels), err)
+	}
+}
@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"math"
+	"os"
+	"strings"
+)
+
+var ErrInvalidSTL = errors.New("invalid STL")
+
+// stlFacet is one polygon of an STL file with the normal stored for it.
+type stlFacet struct {
+	normal   [3]float32
+	vertices [][3]float32
+}
+
+// CreateNewSTL loads an ASCII or binary STL file. Vertices are shared between
+// facets wherever the stored facet normals allow it; when the file leaves the
+// normals out, vertices are merged by position and smooth normals generated.
+func CreateNewSTL(modelFPath string) (*common.ObjectPrimitive, error) {
+	data, err := os.ReadFile(modelFPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var facets []stlFacet
+	if isBinarySTL(data) {
+		facets, err = parseBinarySTL(data)
+	} else {
+		facets, err = parseASCIISTL(modelFPath, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hasNormals := true
+	for _, facet := range facets {
+		if facet.normal == [3]float32{} {
+			hasNormals = false
+			break
+		}
+	}
+
+	builder := newMeshBuilder()
+	for _, facet := range facets {
+		corners := make([]uint32, len(facet.vertices))
+		for i, position := range facet.vertices {
+			vertex := Vertex{Position: position}
+			if hasNormals {
+				vertex.Normal = facet.normal
+			}
+			corners[i] = builder.add(vertex)
+		}
+
+		for _, triangle := range Triangulate(facet.vertices) {
+			builder.addTriangle(corners[triangle[0]], corners[triangle[1]], corners[triangle[2]])
+		}
+	}
+
+	if !hasNormals {
+		generateSmoothNormals(builder.obj)
+	}
+	builder.obj.UpdateBounds()
+	return builder.obj, nil
+}
+
+// isBinarySTL reports whether data is a binary STL. Binary files may also
+// start with "solid", so the size implied by the triangle count is checked
+// first.
+func isBinarySTL(data []byte) bool {
+	if len(data) < 84 {
+		return false
+	}
+	count := binary.LittleEndian.Uint32(data[80:])
+	if uint64(len(data)) == 84+uint64(count)*50 {
+		return true
+	}
+	return !bytes.HasPrefix(bytes.TrimSpace(data), []byte("solid"))
+}
+
+func parseBinarySTL(data []byte) ([]stlFacet, error) {
+	count := int(binary.LittleEndian.Uint32(data[80:]))
+	if len(data) < 84+count*50 {
+		return nil, fmt.Errorf("binary STL declares %d triangles but is truncated: %w", count, ErrInvalidSTL)
+	}
+
+	readVec3 := func(at []byte) [3]float32 {
+		return [3]float32{
+			math.Float32frombits(binary.LittleEndian.Uint32(at)),
+			math.Float32frombits(binary.LittleEndian.Uint32(at[4:])),
+			math.Float32frombits(binary.LittleEndian.Uint32(at[8:])),
+		}
+	}
+
+	facets := make([]stlFacet, count)
+	for i := range facets {
+		record := data[84+i*50:]
+		facets[i] = stlFacet{
+			normal:   readVec3(record),
+			vertices: [][3]float32{readVec3(record[12:]), readVec3(record[24:]), readVec3(record[36:])},
+		}
+	}
+	return facets, nil
+}
+
+func parseASCIISTL(filePath string, data []byte) ([]stlFacet, error) {
+	var facets []stlFacet
+	var current *stlFacet
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+
+	fail := func(token string, err error) error {
+		return &OBJParseError{File: filePath, Line: lineNumber, Token: token, Err: err}
+	}
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case strings.HasPrefix(line, "facet"):
+			facet := stlFacet{}
+			if rest := strings.TrimSpace(strings.TrimPrefix(line, "facet")); strings.HasPrefix(rest, "normal") {
+				normal, token, err := parseFloats(strings.TrimPrefix(rest, "normal"), 3)
+				if err != nil {
+					return nil, fail(token, err)
+				}
+				facet.normal = [3]float32{normal[0], normal[1], normal[2]}
+			}
+			current = &facet
+		case strings.HasPrefix(line, "vertex"):
+			if current == nil {
+				return nil, fail(line, ErrInvalidSTL)
+			}
+			position, token, err := parseFloats(line[len("vertex"):], 3)
+			if err != nil {
+				return nil, fail(token, err)
+			}
+			current.vertices = append(current.vertices, [3]float32{position[0], position[1], position[2]})
+		case strings.HasPrefix(line, "endfacet"):
+			if current == nil || len(current.vertices) < 3 {
+				return nil, fail(line, ErrMissingComponent)
+			}
+			facets = append(facets, *current)
+			current = nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return facets, nil
+}
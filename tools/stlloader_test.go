@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSTLQuad(t *testing.T) {
+	ascii := strings.Join([]string{
+		"solid quad",
+		"facet normal 0 0 1", "outer loop", "vertex 0 0 0", "vertex 1 0 0", "vertex 1 1 0", "endloop", "endfacet",
+		"facet normal 0 0 1", "outer loop", "vertex 0 0 0", "vertex 1 1 0", "vertex 0 1 0", "endloop", "endfacet",
+		"endsolid quad",
+	}, "\n")
+
+	binaryData := make([]byte, 84)
+	binary.LittleEndian.PutUint32(binaryData[80:], 2)
+	for _, facet := range [][12]float32{
+		{0, 0, 1, 0, 0, 0, 1, 0, 0, 1, 1, 0},
+		{0, 0, 1, 0, 0, 0, 1, 1, 0, 0, 1, 0},
+	} {
+		for _, value := range facet {
+			binaryData = binary.LittleEndian.AppendUint32(binaryData, math.Float32bits(value))
+		}
+		binaryData = append(binaryData, 0, 0)
+	}
+
+	for name, content := range map[string]string{"ascii": ascii, "binary": string(binaryData)} {
+		obj, err := CreateNewSTL(writeTestFile(t, "quad.stl", content))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(obj.Vertices) != 12 || len(obj.Indices) != 6 {
+			t.Errorf("%s: got %d vertices and %d indices, want 4 and 6", name, len(obj.Vertices)/3, len(obj.Indices))
+		}
+	}
+}
+
+func TestSTLErrors(t *testing.T) {
+	hostile := make([]byte, 84+50)
+	binary.LittleEndian.PutUint32(hostile[80:], 4000000000)
+
+	tests := []struct {
+		name    string
+		content string
+		line    int
+	}{
+		{"hostile triangle count", string(hostile), 0},
+		{"bad vertex", "solid x\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\nvertex 1 x 0\n", 5},
+		{"vertex outside a facet", "solid x\nvertex 0 0 0\n", 2},
+		{"too few vertices", "solid x\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\nendloop\nendfacet\n", 6},
+	}
+
+	for _, test := range tests {
+		_, err := CreateNewSTL(writeTestFile(t, "bad.stl", test.content))
+		if test.line == 0 {
+			if !errors.Is(err, ErrInvalidSTL) {
+				t.Errorf("%s: got %v, want ErrInvalidSTL", test.name, err)
+			}
+			continue
+		}
+
+		var parseErr *OBJParseError
+		if !errors.As(err, &parseErr) || parseErr.Line != test.line {
+			t.Errorf("%s: got %v, want a parse error on line %d", test.name, err, test.line)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"math"
+)
+
+// GenerateTangents fills obj.Tangents with one tangent per vertex, stored as
+// xyz plus a handedness sign in w. Each vertex gets the average of the
+// tangent frames of its triangles, weighted by the corner angle, with the
+// tangent made orthogonal to the vertex normal. This is simpler than
+// MikkTSpace and need not match what baking tools produce. The bitangent is
+// reconstructed in the shader as sign * cross(normal, tangent).
+//
+// The mesh needs positions, UVs and normals. Vertices without usable UVs get
+// an arbitrary tangent perpendicular to their normal.
+func GenerateTangents(obj *common.ObjectPrimitive) {
+	obj.SplitInterleaved()
+	vertexCount := len(obj.Vertices) / 3
+	if vertexCount == 0 {
+		return
+	}
+
+	tangents := make([][3]float64, vertexCount)
+	bitangents := make([][3]float64, vertexCount)
+
+	position := func(i uint32) [3]float32 {
+		return [3]float32{obj.Vertices[i*3], obj.Vertices[i*3+1], obj.Vertices[i*3+2]}
+	}
+	uv := func(i uint32) [2]float32 {
+		if int(i)*2+1 < len(obj.UVs) {
+			return [2]float32{obj.UVs[i*2], obj.UVs[i*2+1]}
+		}
+		return [2]float32{}
+	}
+
+	for t := 0; t+2 < len(obj.Indices); t += 3 {
+		corners := [3]uint32{obj.Indices[t], obj.Indices[t+1], obj.Indices[t+2]}
+		p0, p1, p2 := position(corners[0]), position(corners[1]), position(corners[2])
+		uv0, uv1, uv2 := uv(corners[0]), uv(corners[1]), uv(corners[2])
+
+		e1, e2 := sub64(p1, p0), sub64(p2, p0)
+		du1, dv1 := float64(uv1[0]-uv0[0]), float64(uv1[1]-uv0[1])
+		du2, dv2 := float64(uv2[0]-uv0[0]), float64(uv2[1]-uv0[1])
+
+		det := du1*dv2 - du2*dv1
+		if det == 0 || math.IsNaN(det) {
+			continue // no UV mapping to derive a frame from
+		}
+		r := 1 / det
+
+		tangent := [3]float64{
+			(e1[0]*dv2 - e2[0]*dv1) * r,
+			(e1[1]*dv2 - e2[1]*dv1) * r,
+			(e1[2]*dv2 - e2[2]*dv1) * r,
+		}
+		bitangent := [3]float64{
+			(e2[0]*du1 - e1[0]*du2) * r,
+			(e2[1]*du1 - e1[1]*du2) * r,
+			(e2[2]*du1 - e1[2]*du2) * r,
+		}
+
+		// Normalise before weighting so that the UV scale of a triangle
+		// does not decide how much it contributes.
+		tn, bn := normalize64(tangent), normalize64(bitangent)
+		triangle := [3][3]float32{p0, p1, p2}
+		for k, vertex := range corners {
+			angle := cornerAngle(triangle[k], triangle[(k+1)%3], triangle[(k+2)%3])
+			for i := 0; i < 3; i++ {
+				tangents[vertex][i] += float64(tn[i]) * angle
+				bitangents[vertex][i] += float64(bn[i]) * angle
+			}
+		}
+	}
+
+	obj.Tangents = make([]float32, vertexCount*4)
+	for v := 0; v < vertexCount; v++ {
+		var normal [3]float64
+		if v*3+2 < len(obj.Normals) {
+			normal = [3]float64{float64(obj.Normals[v*3]), float64(obj.Normals[v*3+1]), float64(obj.Normals[v*3+2])}
+		}
+
+		// Gram-Schmidt: remove the part of the tangent along the normal.
+		tangent := tangents[v]
+		d := dot64(normal, tangent)
+		for i := range tangent {
+			tangent[i] -= normal[i] * d
+		}
+		if dot64(tangent, tangent) < 1e-12 {
+			tangent = perpendicular64(normal)
+		}
+		tn := normalize64(tangent)
+
+		w := float32(1)
+		if dot64(cross64(normal, [3]float64{float64(tn[0]), float64(tn[1]), float64(tn[2])}), bitangents[v]) < 0 {
+			w = -1
+		}
+
+		obj.Tangents[v*4] = tn[0]
+		obj.Tangents[v*4+1] = tn[1]
+		obj.Tangents[v*4+2] = tn[2]
+		obj.Tangents[v*4+3] = w
+	}
+}
+
+func dot64(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+// perpendicular64 returns some vector perpendicular to n.
+func perpendicular64(n [3]float64) [3]float64 {
+	axis := [3]float64{1, 0, 0}
+	if math.Abs(n[0]) > 0.9 {
+		axis = [3]float64{0, 1, 0}
+	}
+	return cross64(n, axis)
+}
@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"github.com/UpsilonDiesBackwards/LibraryOfBabel/engine/common"
+	"math"
+	"testing"
+)
+
+// tangentQuad returns a unit quad in the XY plane with the given UVs at its
+// corners, in the order (0,0), (1,0), (1,1), (0,1), and normal on every
+// vertex.
+func tangentQuad(uvs []float32, normal [3]float32) *common.ObjectPrimitive {
+	obj := &common.ObjectPrimitive{
+		Vertices: []float32{0, 0, 0, 1, 0, 0, 1, 1, 0, 0, 1, 0},
+		UVs:      uvs,
+		Indices:  []uint32{0, 1, 2, 0, 2, 3},
+	}
+	for i := 0; i < 4; i++ {
+		obj.Normals = append(obj.Normals, normal[:]...)
+	}
+	return obj
+}
+
+func TestGenerateTangents(t *testing.T) {
+	s := float32(math.Sqrt(0.5))
+	tests := []struct {
+		name   string
+		uvs    []float32
+		normal [3]float32
+		want   [4]float32
+	}{
+		{"uv along xy", []float32{0, 0, 1, 0, 1, 1, 0, 1}, [3]float32{0, 0, 1}, [4]float32{1, 0, 0, 1}},
+		{"mirrored u", []float32{1, 0, 0, 0, 0, 1, 1, 1}, [3]float32{0, 0, 1}, [4]float32{-1, 0, 0, -1}},
+		{"mirrored v", []float32{0, 1, 1, 1, 1, 0, 0, 0}, [3]float32{0, 0, 1}, [4]float32{1, 0, 0, -1}},
+		// The tangent loses its part along a normal that is not the face's.
+		{"tilted normal", []float32{0, 0, 1, 0, 1, 1, 0, 1}, [3]float32{s, 0, s}, [4]float32{s, 0, -s, 1}},
+	}
+
+	for _, test := range tests {
+		obj := tangentQuad(test.uvs, test.normal)
+		GenerateTangents(obj)
+		if len(obj.Tangents) != 16 {
+			t.Fatalf("%s: got %d tangent values, want 16", test.name, len(obj.Tangents))
+		}
+		for v := 0; v < 4; v++ {
+			tangent := obj.Tangents[v*4 : v*4+4]
+			for k := range tangent {
+				if math.Abs(float64(tangent[k]-test.want[k])) > 1e-5 {
+					t.Errorf("%s: vertex %d has tangent %v, want %v", test.name, v, tangent, test.want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateTangentsWithoutUVs(t *testing.T) {
+	obj := tangentQuad(nil, [3]float32{0, 0, 1})
+	GenerateTangents(obj)
+	for v := 0; v < 4; v++ {
+		tangent := obj.Tangents[v*4 : v*4+4]
+		length := math.Sqrt(float64(tangent[0]*tangent[0] + tangent[1]*tangent[1] + tangent[2]*tangent[2]))
+		if math.Abs(float64(tangent[2])) > 1e-5 || math.Abs(length-1) > 1e-5 || math.Abs(float64(tangent[3])) != 1 {
+			t.Errorf("vertex %d: got tangent %v, want a unit vector perpendicular to +z and w of ±1", v, tangent)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package tools
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/go-gl/gl/v4.2-core/gl"
 	"image"
 	_ "image/jpeg"
 	_ "image/png"
+	"io"
 	"os"
 )
 
@@ -16,7 +18,17 @@ func LoadTexture(filepath string) (uint32, error) {
 	}
 	defer imgFile.Close()
 
-	img, _, err := image.Decode(imgFile)
+	return loadTextureFromReader(imgFile)
+}
+
+// LoadTextureData creates a texture from an encoded image held in memory, such
+// as one embedded in a glTF binary.
+func LoadTextureData(data []byte) (uint32, error) {
+	return loadTextureFromReader(bytes.NewReader(data))
+}
+
+func loadTextureFromReader(r io.Reader) (uint32, error) {
+	img, _, err := image.Decode(r)
 	if err != nil {
 		return 0, err
 	}
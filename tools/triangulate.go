@@ -0,0 +1,148 @@
+package tools
+
+import "math"
+
+// Triangulate splits a polygon into triangles. The polygon is given as the
+// positions of its corners in winding order and the result indexes into that
+// slice, preserving the winding. Convex polygons are fanned from the first
+// corner; concave ones are ear-clipped.
+func Triangulate(polygon [][3]float32) [][3]int {
+	var t triangulator
+	return t.triangulate(polygon)
+}
+
+// triangulator keeps its buffers between calls so that loaders splitting
+// millions of faces do not allocate for each one. The returned triangles are
+// only valid until the next call.
+type triangulator struct {
+	points    [][2]float64
+	triangles [][3]int
+}
+
+func (t *triangulator) triangulate(polygon [][3]float32) [][3]int {
+	n := len(polygon)
+	if n < 3 {
+		return nil
+	}
+	if n == 3 {
+		return append(t.triangles[:0], [3]int{0, 1, 2})
+	}
+
+	t.points = projectPolygon(t.points[:0], polygon)
+
+	if isConvex(t.points) {
+		t.triangles = t.triangles[:0]
+		for i := 1; i < n-1; i++ {
+			t.triangles = append(t.triangles, [3]int{0, i, i + 1})
+		}
+		return t.triangles
+	}
+
+	return earClip(t.points)
+}
+
+// projectPolygon flattens a polygon onto the plane most aligned with its
+// Newell normal, keeping counter-clockwise polygons counter-clockwise. The
+// projected points are appended to points.
+func projectPolygon(points [][2]float64, polygon [][3]float32) [][2]float64 {
+	var nx, ny, nz float64
+	for i := range polygon {
+		a, b := polygon[i], polygon[(i+1)%len(polygon)]
+		nx += float64(a[1]-b[1]) * float64(a[2]+b[2])
+		ny += float64(a[2]-b[2]) * float64(a[0]+b[0])
+		nz += float64(a[0]-b[0]) * float64(a[1]+b[1])
+	}
+
+	// Pick the two axes to keep and whether dropping the third mirrors the
+	// polygon.
+	u, v := 0, 1
+	flip := nz < 0
+	ax, ay, az := math.Abs(nx), math.Abs(ny), math.Abs(nz)
+	if ax > ay && ax > az {
+		u, v = 1, 2
+		flip = nx < 0
+	} else if ay > az {
+		u, v = 2, 0
+		flip = ny < 0
+	}
+
+	for _, p := range polygon {
+		point := [2]float64{float64(p[u]), float64(p[v])}
+		if flip {
+			point[1] = -point[1]
+		}
+		points = append(points, point)
+	}
+	return points
+}
+
+func cross2(o, a, b [2]float64) float64 {
+	return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0])
+}
+
+func isConvex(points [][2]float64) bool {
+	n := len(points)
+	for i := 0; i < n; i++ {
+		if cross2(points[i], points[(i+1)%n], points[(i+2)%n]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func pointInTriangle(p, a, b, c [2]float64) bool {
+	return cross2(a, b, p) >= 0 && cross2(b, c, p) >= 0 && cross2(c, a, p) >= 0
+}
+
+// earClip triangulates a simple counter-clockwise polygon. If no ear can be
+// found, which only happens for self-intersecting or degenerate input, the
+// remaining corners are fanned so that no geometry is dropped.
+func earClip(points [][2]float64) [][3]int {
+	remaining := make([]int, len(points))
+	for i := range remaining {
+		remaining[i] = i
+	}
+
+	triangles := make([][3]int, 0, len(points)-2)
+	for len(remaining) > 3 {
+		n := len(remaining)
+		clipped := false
+
+		for i := 0; i < n; i++ {
+			prev, curr, next := remaining[(i+n-1)%n], remaining[i], remaining[(i+1)%n]
+			a, b, c := points[prev], points[curr], points[next]
+
+			if cross2(a, b, c) <= 0 {
+				continue // reflex or degenerate corner
+			}
+
+			ear := true
+			for _, j := range remaining {
+				if j == prev || j == curr || j == next {
+					continue
+				}
+				if pointInTriangle(points[j], a, b, c) {
+					ear = false
+					break
+				}
+			}
+			if !ear {
+				continue
+			}
+
+			triangles = append(triangles, [3]int{prev, curr, next})
+			remaining = append(remaining[:i], remaining[i+1:]...)
+			clipped = true
+			break
+		}
+
+		if !clipped {
+			for i := 1; i < len(remaining)-1; i++ {
+				triangles = append(triangles, [3]int{remaining[0], remaining[i], remaining[i+1]})
+			}
+			return triangles
+		}
+	}
+
+	return append(triangles, [3]int{remaining[0], remaining[1], remaining[2]})
+}
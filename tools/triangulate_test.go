@@ -0,0 +1,59 @@
+package tools
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTriangulate(t *testing.T) {
+	tests := []struct {
+		name    string
+		polygon [][3]float32
+	}{
+		{"triangle", [][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}},
+		{"convex quad", [][3]float32{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}}},
+		{"L shape", [][3]float32{{0, 0, 0}, {2, 0, 0}, {2, 1, 0}, {1, 1, 0}, {1, 2, 0}, {0, 2, 0}}},
+		{"arrow", [][3]float32{{0, 0, 0}, {2, 1, 0}, {0, 2, 0}, {0.5, 1, 0}}},
+		{"reflex first corner", [][3]float32{{0.5, 1, 0}, {0, 0, 0}, {2, 1, 0}, {0, 2, 0}}},
+		{"star", [][3]float32{{0, 3, 0}, {-1, 1, 0}, {-3, 1, 0}, {-1.5, -0.5, 0}, {-2, -3, 0}, {0, -1.5, 0}, {2, -3, 0}, {1.5, -0.5, 0}, {3, 1, 0}, {1, 1, 0}}},
+		{"clockwise L in xz", [][3]float32{{0, 0, 0}, {0, 0, 2}, {1, 0, 2}, {1, 0, 1}, {2, 0, 1}, {2, 0, 0}}},
+		{"tilted comb", [][3]float32{{0, 0, 0}, {3, 0, 3}, {3, 2, 3}, {2, 2, 2}, {2, 1, 2}, {1, 1, 1}, {1, 2, 1}, {0, 2, 0}}},
+	}
+
+	for _, test := range tests {
+		triangles := Triangulate(test.polygon)
+		if len(triangles) != len(test.polygon)-2 {
+			t.Errorf("%s: got %d triangles, want %d", test.name, len(triangles), len(test.polygon)-2)
+			continue
+		}
+
+		// Every triangle keeps the polygon's winding and together they cover
+		// exactly its area, so none overlap or reach outside it.
+		normal := newellNormal(test.polygon)
+		area := math.Sqrt(dot64(normal, normal)) / 2
+		covered := 0.0
+		for _, triangle := range triangles {
+			a, b, c := test.polygon[triangle[0]], test.polygon[triangle[1]], test.polygon[triangle[2]]
+			cross := cross64(sub64(b, a), sub64(c, a))
+			if dot64(cross, normal) <= 0 {
+				t.Errorf("%s: triangle %v is wound the wrong way", test.name, triangle)
+			}
+			covered += math.Sqrt(dot64(cross, cross)) / 2
+		}
+		if math.Abs(covered-area) > 1e-6 {
+			t.Errorf("%s: triangles cover %g, polygon area is %g", test.name, covered, area)
+		}
+	}
+}
+
+// newellNormal returns the normal of a polygon scaled to twice its area.
+func newellNormal(polygon [][3]float32) [3]float64 {
+	var normal [3]float64
+	for i := range polygon {
+		a, b := polygon[i], polygon[(i+1)%len(polygon)]
+		normal[0] += float64(a[1]-b[1]) * float64(a[2]+b[2])
+		normal[1] += float64(a[2]-b[2]) * float64(a[0]+b[0])
+		normal[2] += float64(a[0]-b[0]) * float64(a[1]+b[1])
+	}
+	return normal
+}